@@ -0,0 +1,34 @@
+package huff
+
+// ByteTable returns a decode table for a byte alphabet indexed by the next
+// 15 bits of input: syms[i] is the decoded byte and lens[i] its code length.
+// Entries for EOF have 0x80 set in lens, and entries matching no code have
+// a length of zero.  ok is false if any symbol is not a byte or any code is
+// longer than 15 bits.
+func (d *Decoder) ByteTable() (syms [1 << 15]byte, lens [1 << 15]byte, ok bool) {
+	const bits = 15
+
+	for _, sym := range d.sym {
+		if sym.length > bits || sym.s > 0xff && sym.s != d.eof {
+			return syms, lens, false
+		}
+	}
+
+	for _, sym := range d.sym {
+		shift := uint(bits - sym.length)
+		start := sym.code << shift
+		end := (sym.code + 1) << shift
+
+		l := byte(sym.length)
+		if sym.s == d.eof {
+			l |= 0x80
+		}
+
+		for i := start; i < end; i++ {
+			syms[i] = byte(sym.s)
+			lens[i] = l
+		}
+	}
+
+	return syms, lens, true
+}
@@ -0,0 +1,111 @@
+package huff
+
+import (
+	"errors"
+	"testing"
+)
+
+// tableDecode decodes data up to EOF using the tables from ByteTable
+func tableDecode(syms, lens *[1 << 15]byte, data []byte) ([]byte, error) {
+	var out []byte
+
+	var buf uint64 // bits are consumed from the top
+	var n uint     // number of valid bits in buf
+	for pos := 0; ; {
+		for n <= 56 {
+			var b byte
+			if pos < len(data) {
+				b = data[pos]
+			}
+			pos++
+			buf |= uint64(b) << (56 - n)
+			n += 8
+		}
+
+		idx := buf >> (64 - 15)
+		l := lens[idx]
+		if l == 0 {
+			return out, ErrUnknownSymbol
+		}
+		if l&0x80 != 0 {
+			return out, nil
+		}
+
+		if pos-len(data) > 8 {
+			return out, errors.New("ran off the end of the data")
+		}
+
+		out = append(out, syms[idx])
+		buf <<= l
+		n -= uint(l)
+	}
+}
+
+func byteTableData() (*Encoder, []byte, []byte) {
+	counts := make([]int, 256)
+	var raw []byte
+	for i := 0; i < 20000; i++ {
+		b := byte((i*i + 5*i) % 97 % (1 + i%40))
+		raw = append(raw, b)
+		counts[b]++
+	}
+	e := NewEncoder(counts)
+
+	syms := make([]uint32, len(raw))
+	for i, b := range raw {
+		syms[i] = uint32(b)
+	}
+	return e, raw, encodeSymbols(e, syms)
+}
+
+func TestByteTable(t *testing.T) {
+
+	e, raw, data := byteTableData()
+
+	syms, lens, ok := e.Decoder().ByteTable()
+	if !ok {
+		t.Fatalf("ByteTable not ok")
+	}
+
+	got, err := tableDecode(&syms, &lens, data)
+	if err != nil {
+		t.Fatalf("tableDecode: %v", err)
+	}
+	if string(got) != string(raw) {
+		t.Errorf("table decode mismatch")
+	}
+
+	// codes longer than 15 bits
+	counts := make([]int, 24)
+	for i := range counts {
+		counts[i] = 1 << uint(i)
+	}
+	if _, _, ok := NewEncoder(counts).Decoder().ByteTable(); ok {
+		t.Errorf("long codes: ok = true")
+	}
+
+	// symbols that aren't bytes
+	wide := make([]int, 300)
+	wide[299] = 1
+	if _, _, ok := NewEncoder(wide).Decoder().ByteTable(); ok {
+		t.Errorf("wide alphabet: ok = true")
+	}
+}
+
+func BenchmarkByteTable(b *testing.B) {
+	e, raw, data := byteTableData()
+	syms, lens, _ := e.Decoder().ByteTable()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		tableDecode(&syms, &lens, data)
+	}
+}
+
+func BenchmarkByteReadSymbol(b *testing.B) {
+	e, raw, data := byteTableData()
+	d := e.Decoder()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		d.DecodeBytes(data)
+	}
+}
@@ -0,0 +1,63 @@
+package huff
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+// Checkpoint records how far decoding has progressed through a stream.
+type Checkpoint struct {
+	BitOffset int64 // bits consumed from the start of the stream
+	Symbols   int   // symbols decoded so far
+}
+
+// DecodeWithCheckpoints is like DecodeBytes, but calls cb after every
+// `every` symbols with the position reached.
+func (d *Decoder) DecodeWithCheckpoints(data []byte, every int, cb func(Checkpoint)) ([]uint32, error) {
+	return d.decodeFrom(data, Checkpoint{}, every, cb)
+}
+
+// ResumeFrom decodes the symbols in data after the checkpoint cp.
+func (d *Decoder) ResumeFrom(data []byte, cp Checkpoint) ([]uint32, error) {
+	return d.decodeFrom(data, cp, 0, nil)
+}
+
+func (d *Decoder) decodeFrom(data []byte, cp Checkpoint, every int, cb func(Checkpoint)) ([]uint32, error) {
+	if cp.BitOffset < 0 || cp.BitOffset > int64(len(data))*8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	br := bitstream.NewReader(bytes.NewReader(data[cp.BitOffset/8:]))
+	if _, err := br.ReadBits(int(cp.BitOffset % 8)); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// the symbols before cp count towards any recorded total
+	if d.total >= 0 {
+		rest := *d
+		rest.total -= int64(cp.Symbols)
+		if rest.total < 0 {
+			return nil, ErrSymbolCount
+		}
+		d = &rest
+	}
+
+	var out []uint32
+	_, err := d.decode(br, func(s uint32, l int) error {
+		if s == EOF {
+			return nil
+		}
+
+		out = append(out, s)
+		cp.BitOffset += int64(l)
+		cp.Symbols++
+
+		if cb != nil && every > 0 && cp.Symbols%every == 0 {
+			cb(cp)
+		}
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,85 @@
+package huff
+
+import "testing"
+
+func TestCheckpoints(t *testing.T) {
+
+	counts := make([]int, 32)
+	var syms []uint32
+	for i := 0; i < 1000; i++ {
+		s := uint32(i*i%31) & uint32(i%8)
+		syms = append(syms, s)
+		counts[s]++
+	}
+
+	e := NewEncoder(counts)
+	data := encodeSymbols(e, syms)
+	d := e.Decoder()
+
+	var cps []Checkpoint
+	full, err := d.DecodeWithCheckpoints(data, 100, func(cp Checkpoint) { cps = append(cps, cp) })
+	if err != nil {
+		t.Fatalf("DecodeWithCheckpoints: %v", err)
+	}
+
+	if len(full) != len(syms) {
+		t.Fatalf("decoded %d symbols, want %d", len(full), len(syms))
+	}
+	if len(cps) != len(syms)/100 {
+		t.Fatalf("got %d checkpoints, want %d", len(cps), len(syms)/100)
+	}
+
+	for _, cp := range cps {
+		off, _ := e.BitOffsetAfter(syms, cp.Symbols)
+		if cp.BitOffset != off {
+			t.Errorf("checkpoint at %d symbols: bit offset %d, want %d", cp.Symbols, cp.BitOffset, off)
+		}
+	}
+
+	cp := cps[len(cps)/2]
+	rest, err := d.ResumeFrom(data, cp)
+	if err != nil {
+		t.Fatalf("ResumeFrom: %v", err)
+	}
+
+	resumed := append(full[:cp.Symbols:cp.Symbols], rest...)
+	if len(resumed) != len(syms) {
+		t.Fatalf("resumed decode has %d symbols, want %d", len(resumed), len(syms))
+	}
+	for i := range syms {
+		if resumed[i] != syms[i] {
+			t.Fatalf("symbol %d: got %d, want %d", i, resumed[i], syms[i])
+		}
+	}
+}
+
+func TestCheckpointsCounted(t *testing.T) {
+
+	e := NewEncoder([]int{10, 6, 3, 1})
+	syms := []uint32{0, 1, 2, 3, 0, 0, 1}
+	data := encodeSymbols(e, syms)
+
+	short, err := NewDecoderCounted(e.CodebookBytesCounted(3))
+	if err != nil {
+		t.Fatalf("NewDecoderCounted: %v", err)
+	}
+	if _, err := short.DecodeWithCheckpoints(data, 2, func(Checkpoint) {}); err != ErrSymbolCount {
+		t.Errorf("DecodeWithCheckpoints err = %v, want %v", err, ErrSymbolCount)
+	}
+
+	// resuming counts the symbols before the checkpoint
+	d, err := NewDecoderCounted(e.CodebookBytesCounted(len(syms)))
+	if err != nil {
+		t.Fatalf("NewDecoderCounted: %v", err)
+	}
+	var cps []Checkpoint
+	if _, err := d.DecodeWithCheckpoints(data, 3, func(cp Checkpoint) { cps = append(cps, cp) }); err != nil {
+		t.Fatalf("DecodeWithCheckpoints: %v", err)
+	}
+	if rest, err := d.ResumeFrom(data, cps[0]); err != nil || len(rest) != len(syms)-cps[0].Symbols {
+		t.Errorf("ResumeFrom = %v (%v), want %v", rest, err, syms[cps[0].Symbols:])
+	}
+	if _, err := short.ResumeFrom(data, cps[1]); err != ErrSymbolCount {
+		t.Errorf("ResumeFrom past the count: err = %v, want %v", err, ErrSymbolCount)
+	}
+}
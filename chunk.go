@@ -0,0 +1,47 @@
+package huff
+
+// OptimalChunkSize returns the chunk size that minimizes the bits needed to
+// send syms as consecutive chunks, each with its own huffman codebook of
+// codebookBits bits and terminated by EOF.  Small chunks follow a drifting
+// distribution closely but pay for more codebooks; the sizes tried are the
+// powers of two below len(syms), and len(syms) itself.  Ties go to the
+// larger size.
+func OptimalChunkSize(syms []uint32, codebookBits int) int {
+	if len(syms) == 0 {
+		return 0
+	}
+
+	best, bestBits := len(syms), chunkedBits(syms, len(syms), codebookBits)
+	for size := 1; size < len(syms); size *= 2 {
+		if bits := chunkedBits(syms, size, codebookBits); bits < bestBits {
+			best, bestBits = size, bits
+		}
+	}
+	return best
+}
+
+// chunkedBits returns the bits needed to send syms in chunks of size symbols
+func chunkedBits(syms []uint32, size, codebookBits int) int64 {
+	var total int64
+	for start := 0; start < len(syms); start += size {
+		chunk := syms[start:min(start+size, len(syms))]
+
+		// code lengths depend only on the counts, so number the distinct
+		// symbols densely rather than build a table up to the largest
+		rank := make(map[uint32]int)
+		var counts []int
+		for _, s := range chunk {
+			r, ok := rank[s]
+			if !ok {
+				r = len(counts)
+				rank[s] = r
+				counts = append(counts, 0)
+			}
+			counts[r]++
+		}
+
+		e := NewEncoder(counts)
+		total += int64(codebookBits) + e.EncodedBits(counts)
+	}
+	return total
+}
@@ -0,0 +1,56 @@
+package huff
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestOptimalChunkSize(t *testing.T) {
+
+	// two regimes, each using its own four symbols
+	rnd := rand.New(rand.NewSource(3))
+	syms := make([]uint32, 8192)
+	for i := range syms {
+		syms[i] = uint32(rnd.Intn(4))
+		if i >= 4096 {
+			syms[i] += 4
+		}
+	}
+
+	size := OptimalChunkSize(syms, 64)
+	if 4096%size != 0 {
+		t.Errorf("chunk size %d puts no boundary at the regime change at 4096", size)
+	}
+	if size < 1024 {
+		t.Errorf("chunk size %d pays for more codebooks than needed", size)
+	}
+
+	// a stationary stream is best sent in one chunk
+	for i := range syms {
+		syms[i] = uint32(rnd.Intn(4))
+	}
+	if size := OptimalChunkSize(syms, 64); size != len(syms) {
+		t.Errorf("stationary chunk size = %d, want %d", size, len(syms))
+	}
+
+	if size := OptimalChunkSize(nil, 64); size != 0 {
+		t.Errorf("empty chunk size = %d, want 0", size)
+	}
+}
+
+func TestOptimalChunkSizeSparse(t *testing.T) {
+
+	// large symbol values mustn't cost a table entry for every smaller one
+	rnd := rand.New(rand.NewSource(5))
+	syms := make([]uint32, 2048)
+	for i := range syms {
+		syms[i] = uint32(rnd.Intn(4)) << 18
+		if i >= 1024 {
+			syms[i]++
+		}
+	}
+
+	if size := OptimalChunkSize(syms, 64); 1024%size != 0 || size < 256 {
+		t.Errorf("chunk size %d, want a divisor of 1024 of at least 256", size)
+	}
+}
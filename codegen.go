@@ -0,0 +1,76 @@
+package huff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// firstCodes returns the first canonical code of each length
+func firstCodes(numl []uint32) []uint32 {
+	first := make([]uint32, len(numl))
+	var code uint32
+	for l := 1; l < len(numl); l++ {
+		first[l] = code
+		code = (code + numl[l]) << 1
+	}
+	return first
+}
+
+func writeCArray(b *bytes.Buffer, name string, vals []uint32) {
+	fmt.Fprintf(b, "const uint32_t %s[%d] = {", name, len(vals))
+	for i, v := range vals {
+		if i%8 == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(b, "%d,", v)
+	}
+	b.WriteString("\n};\n\n")
+}
+
+// WriteCSource writes the decode tables for the codebook as C source.  For
+// each code length l, varName_count[l] is the number of codes of that
+// length and varName_first[l] the first code; varName_symbol lists the
+// symbols in canonical code order.  varName_eof is the symbol used for EOF.
+func (e *Encoder) WriteCSource(w io.Writer, varName string) error {
+	var b bytes.Buffer
+
+	b.WriteString("/* Code generated by go-huff. DO NOT EDIT. */\n\n#include <stdint.h>\n\n")
+
+	fmt.Fprintf(&b, "const uint32_t %s_eof = %d;\n", varName, e.eof)
+	fmt.Fprintf(&b, "const int %s_maxlen = %d;\n\n", varName, len(e.numl)-1)
+
+	syms := make([]uint32, len(e.sym))
+	for i, sym := range e.sym {
+		syms[i] = sym.s
+	}
+
+	writeCArray(&b, varName+"_count", e.numl)
+	writeCArray(&b, varName+"_first", firstCodes(e.numl))
+	writeCArray(&b, varName+"_symbol", syms)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WritePythonSource writes the codebook as Python source: a dict named
+// varName mapping each symbol to its (code, length), and varName_EOF, the
+// symbol used for EOF.
+func (e *Encoder) WritePythonSource(w io.Writer, varName string) error {
+	var b bytes.Buffer
+
+	b.WriteString("# Code generated by go-huff. DO NOT EDIT.\n\n")
+
+	fmt.Fprintf(&b, "%s_EOF = %d\n\n", varName, e.eof)
+
+	fmt.Fprintf(&b, "%s = {\n", varName)
+	for _, sym := range e.sym {
+		fmt.Fprintf(&b, "    %d: (0b%0*b, %d),\n", sym.s, sym.length, sym.code, sym.length)
+	}
+	b.WriteString("}\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,91 @@
+package huff
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSource(t *testing.T) {
+
+	// lengths 1, 2, 3, 4, 4 (EOF): codes 0, 10, 110, 1110, 1111
+	e := NewEncoder([]int{16, 8, 4, 2})
+
+	var b bytes.Buffer
+	if err := e.WriteCSource(&b, "tbl"); err != nil {
+		t.Fatalf("WriteCSource: %v", err)
+	}
+
+	src := b.String()
+	for _, want := range []string{
+		"const uint32_t tbl_eof = 4;",
+		"const int tbl_maxlen = 4;",
+		"const uint32_t tbl_count[5] = {\n\t0, 1, 1, 1, 2,\n};",
+		"const uint32_t tbl_first[5] = {\n\t0, 0, 2, 6, 14,\n};",
+		"const uint32_t tbl_symbol[5] = {\n\t0, 1, 2, 3, 4,\n};",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("output missing %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestWritePythonSource(t *testing.T) {
+
+	counts := []int{16, 0, 8, 4, 2}
+	e := NewEncoder(counts)
+
+	var b bytes.Buffer
+	if err := e.WritePythonSource(&b, "tbl"); err != nil {
+		t.Fatalf("WritePythonSource: %v", err)
+	}
+
+	src := b.String()
+
+	for _, want := range []string{"tbl_EOF = 5\n\n", "tbl = {\n"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("output missing %q:\n%s", want, src)
+		}
+	}
+
+	// parse the dict entries back
+	entry := regexp.MustCompile(`(?m)^    (\d+): \(0b([01]+), (\d+)\),$`)
+	got := make(map[uint32]string)
+	for _, m := range entry.FindAllStringSubmatch(src, -1) {
+		s, _ := strconv.Atoi(m[1])
+		l, _ := strconv.Atoi(m[3])
+		if len(m[2]) != l {
+			t.Errorf("symbol %s: code %s has length %d", m[1], m[2], l)
+		}
+		got[uint32(s)] = m[2]
+	}
+
+	for i, v := range counts {
+		s := uint32(i)
+		if v == 0 {
+			if _, ok := got[s]; ok {
+				t.Errorf("zero count symbol %d in output", s)
+			}
+			continue
+		}
+		sym := e.m[s]
+		if want := fmt.Sprintf("%0*b", sym.length, sym.code); got[s] != want {
+			t.Errorf("symbol %d: code %q, want %q", s, got[s], want)
+		}
+	}
+
+	if _, ok := got[5]; !ok {
+		t.Errorf("EOF missing from output")
+	}
+
+	if py, err := exec.LookPath("python3"); err == nil {
+		cmd := exec.Command(py, "-c", src+"\nassert len(tbl) == 5")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("python3: %v\n%s", err, out)
+		}
+	}
+}
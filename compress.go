@@ -0,0 +1,99 @@
+package huff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+// Compress huffman codes data as bytes, returning the codebook followed by
+// the encoded bytes.  Codes are limited to DefaultMaxCodeLen bits, so the
+// output is always decodable however skewed data is.
+func Compress(data []byte) []byte {
+	// a byte alphabet and EOF always fit in DefaultMaxCodeLen bits
+	b, _, _ := compress(data, DefaultMaxCodeLen)
+	return b
+}
+
+// compress is Compress with codes limited to maxLen bits, also returning the
+// encoder used
+func compress(data []byte, maxLen int) ([]byte, *Encoder, error) {
+	counts := make([]int, 256)
+	for _, b := range data {
+		counts[b]++
+	}
+
+	e, err := NewEncoderLimited(counts, maxLen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var b bytes.Buffer
+	b.Write(e.CodebookBytes())
+
+	w := e.Writer(&b)
+	for _, v := range data {
+		w.WriteSymbol(uint32(v))
+	}
+	w.WriteSymbol(EOF)
+	w.Close()
+
+	return b.Bytes(), e, nil
+}
+
+// Decompress reverses Compress.
+func Decompress(data []byte) ([]byte, error) {
+	syms, err := decodeWithCodebook(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(syms))
+	for i, s := range syms {
+		if s > 0xff {
+			return nil, ErrSymbolRange
+		}
+		out[i] = byte(s)
+	}
+
+	return out, nil
+}
+
+// decodeWithCodebook decodes a codebook followed by the symbols encoded with it
+func decodeWithCodebook(data []byte) ([]uint32, error) {
+	r := bytes.NewReader(data)
+
+	var c codebook
+	if err := c.readFrom(r); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return newDecoder(c).decodeAll(bitstream.NewReader(r))
+}
+
+var ErrMismatch = errors.New("huff: round trip mismatch")
+
+// RoundTripFile compresses and decompresses the contents of the file at path,
+// returning ErrMismatch if the result differs from the original.
+func RoundTripFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	out, err := Decompress(Compress(data))
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(data, out) {
+		return ErrMismatch
+	}
+
+	return nil
+}
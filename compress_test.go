@@ -0,0 +1,77 @@
+package huff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+
+	for _, data := range [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("aaaaaaaaaaaaaaaa"),
+		bytes.Repeat([]byte("hello, world\n"), 100),
+		{0, 1, 2, 255, 254, 0, 0, 0},
+	} {
+		c := Compress(data)
+		got, err := Decompress(c)
+		if err != nil {
+			t.Fatalf("Decompress(%q): %v", data, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("round trip of %q gave %q", data, got)
+		}
+	}
+
+	if _, err := Decompress([]byte{3, 1}); err != ErrInvalidCodebook {
+		t.Errorf("truncated codebook: err = %v, want %v", err, ErrInvalidCodebook)
+	}
+}
+
+func TestRoundTripFile(t *testing.T) {
+
+	var data []byte
+	data = append(data, bytes.Repeat([]byte("plain text, with some punctuation!\n"), 50)...)
+	for i := 0; i < 4096; i++ {
+		data = append(data, byte(i*i>>3))
+	}
+	data = append(data, "UTF-8: Grüße, 日本語\n"...)
+
+	path := filepath.Join(t.TempDir(), "mixed")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RoundTripFile(path); err != nil {
+		t.Errorf("RoundTripFile: %v", err)
+	}
+
+	if err := RoundTripFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("missing file: no error")
+	}
+}
+
+func TestCompressSkewed(t *testing.T) {
+
+	// fibonacci counts need codes longer than 32 bits without a limit
+	fib := fibCounts(34)
+	if l := maxSymbolLen(NewEncoder(fib), len(fib)); l <= 32 {
+		t.Fatalf("unlimited fibonacci code only %d bits long", l)
+	}
+
+	var data []byte
+	for i, v := range fib {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, v)...)
+	}
+
+	got, err := Decompress(Compress(data))
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("round trip mismatch")
+	}
+}
@@ -0,0 +1,77 @@
+package huff
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+)
+
+// NewDecoderCSV reads a codebook as CSV records of "symbol,length", one per
+// symbol.  Lines starting with # are ignored.  The lengths must form a
+// complete prefix code, and as with NewDecoder the highest symbol is EOF.
+// Only the symbols listed are stored, so a large symbol doesn't cost a
+// table entry for every smaller one.
+func NewDecoderCSV(r io.Reader) (*Decoder, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	lengths := make(map[uint32]int)
+	var last uint32
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := strconv.ParseUint(rec[0], 10, 32)
+		if err != nil {
+			return nil, ErrInvalidCodebook
+		}
+		if s == math.MaxUint32 {
+			// the same as EOF itself
+			return nil, ErrSymbolRange
+		}
+		l, err := strconv.Atoi(rec[1])
+		if err != nil || l < 1 || l > 32 {
+			return nil, ErrInvalidCodebook
+		}
+
+		if _, ok := lengths[uint32(s)]; ok {
+			return nil, ErrDuplicateSymbol
+		}
+		lengths[uint32(s)] = l
+		if uint32(s) > last {
+			last = uint32(s)
+		}
+	}
+
+	if len(lengths) == 0 {
+		return nil, ErrInvalidCodebook
+	}
+
+	c := make(codebook, 0, len(lengths))
+	var kraft uint64
+	for s, l := range lengths {
+		c = append(c, symbol{s: s, length: l})
+		kraft += 1 << uint(32-l)
+	}
+
+	if kraft != 1<<32 {
+		return nil, ErrInvalidCodebook
+	}
+
+	sptrs, numl := c.calculateCodes()
+
+	return &Decoder{
+		eof:   last,
+		numl:  numl,
+		sym:   sptrs,
+		total: -1,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package huff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecoderCSV(t *testing.T) {
+
+	e := NewEncoder([]int{12, 0, 5, 3, 1})
+	syms := []uint32{0, 2, 3, 4, 0, 0, 2}
+	data := encodeSymbols(e, syms)
+
+	var src strings.Builder
+	src.WriteString("# symbol,length\n")
+	for _, s := range []uint32{0, 2, 3, 4, 5} {
+		src.WriteString(strconv.Itoa(int(s)) + ", " + strconv.Itoa(e.SymbolLen(s)) + "\n")
+	}
+	if !strings.Contains(src.String(), "5, ") {
+		t.Fatalf("EOF not in CSV:\n%s", src.String())
+	}
+
+	d, err := NewDecoderCSV(strings.NewReader(src.String()))
+	if err != nil {
+		t.Fatalf("NewDecoderCSV: %v", err)
+	}
+
+	got, err := d.DecodeBytes(data)
+	if err != nil {
+		t.Fatalf("DecodeBytes: %v", err)
+	}
+	if len(got) != len(syms) {
+		t.Fatalf("got %v, want %v", got, syms)
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Fatalf("got %v, want %v", got, syms)
+		}
+	}
+
+	for _, tt := range []struct {
+		csv string
+		err error
+	}{
+		{"0,1\n1,2\n", ErrInvalidCodebook},
+		{"0,1\n1,1\n2,1\n", ErrInvalidCodebook},
+		{"0,1\n1,2\n1,2\n", ErrDuplicateSymbol},
+		{"0,1\nx,1\n", ErrInvalidCodebook},
+		{"0,0\n1,1\n", ErrInvalidCodebook},
+		{"", ErrInvalidCodebook},
+		{"0,1\n4294967295,1\n", ErrSymbolRange},
+	} {
+		if _, err := NewDecoderCSV(strings.NewReader(tt.csv)); err != tt.err {
+			t.Errorf("%q: err = %v, want %v", tt.csv, err, tt.err)
+		}
+	}
+}
+
+func TestDecoderCSVSparse(t *testing.T) {
+
+	// EOF far above the other symbols needs no table entry for those between
+	d, err := NewDecoderCSV(strings.NewReader("0,1\n7,2\n4294967294,2\n"))
+	if err != nil {
+		t.Fatalf("NewDecoderCSV: %v", err)
+	}
+	if len(d.sym) != 3 || d.eof != 4294967294 {
+		t.Errorf("%d symbols, EOF %d, want 3 and 4294967294", len(d.sym), d.eof)
+	}
+
+	// 0, 10, 11 (EOF)
+	got, err := d.DecodeBytes([]byte{0x58})
+	if err != nil || len(got) != 2 || got[0] != 0 || got[1] != 7 {
+		t.Errorf("DecodeBytes = %v (%v), want [0 7]", got, err)
+	}
+}
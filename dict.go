@@ -0,0 +1,195 @@
+package huff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+// DictEncoder encodes symbols from an alphabet of n literals together with a
+// dictionary of common sequences.  Each dictionary entry is coded as the
+// single virtual symbol n+i, and the input is split greedily using the
+// longest matching entry at each position.
+type DictEncoder struct {
+	n     int
+	dict  [][]uint32
+	first map[uint32][]int // entry indices by first symbol, longest first
+	e     *Encoder
+}
+
+// NewDictEncoder builds a DictEncoder for literals 0..n-1 and the given
+// sequences, with a codebook fitted to sample.  Every literal gets a code,
+// as if it occurred at least once in sample, so any input over the alphabet
+// can be encoded; entries never seen in sample get no code, and input they
+// would match is encoded as literals instead.
+func NewDictEncoder(n int, dict [][]uint32, sample []uint32) (*DictEncoder, error) {
+	de := &DictEncoder{n: n, dict: dict, first: make(map[uint32][]int)}
+
+	for i, seq := range dict {
+		if len(seq) == 0 {
+			return nil, ErrInvalidCodebook
+		}
+		for _, s := range seq {
+			if s >= uint32(n) {
+				return nil, ErrSymbolRange
+			}
+		}
+		de.first[seq[0]] = append(de.first[seq[0]], i)
+	}
+
+	for _, idx := range de.first {
+		sort.SliceStable(idx, func(i, j int) bool { return len(dict[idx[i]]) > len(dict[idx[j]]) })
+	}
+
+	tokens, err := de.tokens(sample)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int, n+len(dict))
+	for _, t := range tokens {
+		counts[t]++
+	}
+	for i := range counts[:n] {
+		if counts[i] == 0 {
+			counts[i] = 1
+		}
+	}
+	de.e = NewEncoder(counts)
+
+	return de, nil
+}
+
+// tokens splits syms into literals and dictionary references, using only
+// the entries with a code once the encoder has been built
+func (de *DictEncoder) tokens(syms []uint32) ([]uint32, error) {
+	var out []uint32
+	for i := 0; i < len(syms); {
+		s := syms[i]
+		if s >= uint32(de.n) {
+			return nil, ErrSymbolRange
+		}
+
+		tok, l := s, 1
+		for _, idx := range de.first[s] {
+			seq := de.dict[idx]
+			if de.e != nil && de.e.SymbolLen(uint32(de.n+idx)) == 0 {
+				continue
+			}
+			if len(seq) > l && i+len(seq) <= len(syms) && equalSyms(syms[i:i+len(seq)], seq) {
+				tok, l = uint32(de.n+idx), len(seq)
+				break
+			}
+		}
+
+		out = append(out, tok)
+		i += l
+	}
+	return out, nil
+}
+
+func equalSyms(a, b []uint32) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func putUvarint(b *bytes.Buffer, v uint64) {
+	var vbuf [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(vbuf[:], v)
+	b.Write(vbuf[:l])
+}
+
+// Encode returns the alphabet size, the dictionary, the codebook and the
+// encoded symbols.  Use DecodeDict to reverse it.
+func (de *DictEncoder) Encode(syms []uint32) ([]byte, error) {
+	tokens, err := de.tokens(syms)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	putUvarint(&b, uint64(de.n))
+	putUvarint(&b, uint64(len(de.dict)))
+	for _, seq := range de.dict {
+		putUvarint(&b, uint64(len(seq)))
+		for _, s := range seq {
+			putUvarint(&b, uint64(s))
+		}
+	}
+
+	b.Write(de.e.CodebookBytes())
+
+	w := de.e.Writer(&b)
+	for _, t := range tokens {
+		if _, err := w.WriteSymbol(t); err != nil {
+			return nil, err
+		}
+	}
+	w.WriteSymbol(EOF)
+	w.Close()
+
+	return b.Bytes(), nil
+}
+
+// DecodeDict decodes the output of DictEncoder.Encode.
+func DecodeDict(data []byte) ([]uint32, error) {
+	r := bytes.NewReader(data)
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidCodebook
+	}
+	ndict, err := binary.ReadUvarint(r)
+	if err != nil || ndict > uint64(r.Len()) {
+		return nil, ErrInvalidCodebook
+	}
+
+	dict := make([][]uint32, ndict)
+	for i := range dict {
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len()) {
+			return nil, ErrInvalidCodebook
+		}
+		dict[i] = make([]uint32, l)
+		for j := range dict[i] {
+			s, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, ErrInvalidCodebook
+			}
+			dict[i][j] = uint32(s)
+		}
+	}
+
+	var c codebook
+	if err := c.readFrom(r); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	d := newDecoder(c)
+	br := bitstream.NewReader(r)
+
+	var out []uint32
+	_, err = d.decode(br, func(t uint32, _ int) error {
+		switch {
+		case t == EOF:
+		case t < uint32(n):
+			out = append(out, t)
+		case uint64(t)-n < ndict:
+			out = append(out, dict[uint64(t)-n]...)
+		default:
+			return ErrSymbolRange
+		}
+		return nil
+	})
+	return out, err
+}
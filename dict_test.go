@@ -0,0 +1,84 @@
+package huff
+
+import "testing"
+
+func TestDictEncoder(t *testing.T) {
+
+	const n = 64
+
+	dict := [][]uint32{
+		{10, 20, 30, 40, 50},
+		{10, 20},
+		{7, 7, 7, 7, 7, 7, 7, 7},
+	}
+
+	var syms []uint32
+	for i := 0; i < 2000; i++ {
+		switch {
+		case i%9 == 0:
+			syms = append(syms, dict[0]...)
+		case i%13 == 0:
+			syms = append(syms, dict[2]...)
+		case i%17 == 0:
+			syms = append(syms, 10, 20, 1)
+		default:
+			syms = append(syms, uint32(i*i%n))
+		}
+	}
+
+	de, err := NewDictEncoder(n, dict, syms)
+	if err != nil {
+		t.Fatalf("NewDictEncoder: %v", err)
+	}
+
+	data, err := de.Encode(syms)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	got, err := DecodeDict(data)
+	if err != nil {
+		t.Fatalf("DecodeDict: %v", err)
+	}
+	if len(got) != len(syms) {
+		t.Fatalf("got %d symbols, want %d", len(got), len(syms))
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Fatalf("symbol %d: got %d, want %d", i, got[i], syms[i])
+		}
+	}
+
+	counts := make([]int, n)
+	for _, s := range syms {
+		counts[s]++
+	}
+	plain := NewEncoder(counts)
+	if size := plain.CodebookSize() + len(encodeSymbols(plain, syms)); len(data) >= size {
+		t.Errorf("dictionary encoding %d bytes, plain %d bytes", len(data), size)
+	}
+
+	if _, err := de.Encode([]uint32{n}); err != ErrSymbolRange {
+		t.Errorf("literal out of range: err = %v, want %v", err, ErrSymbolRange)
+	}
+
+	// literals and entries missing from the sample still encode
+	small, err := NewDictEncoder(4, [][]uint32{{1, 2}, {3, 3}}, []uint32{0, 0, 1, 2, 0})
+	if err != nil {
+		t.Fatalf("NewDictEncoder: %v", err)
+	}
+	in := []uint32{3, 3, 1, 2, 2, 0}
+	data, err = small.Encode(in)
+	if err != nil {
+		t.Fatalf("unseen symbols: Encode: %v", err)
+	}
+	got, err = DecodeDict(data)
+	if err != nil || len(got) != len(in) {
+		t.Fatalf("unseen symbols: DecodeDict = %v (%v), want %v", got, err, in)
+	}
+	for i := range in {
+		if got[i] != in[i] {
+			t.Fatalf("unseen symbols: DecodeDict = %v, want %v", got, in)
+		}
+	}
+}
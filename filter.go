@@ -0,0 +1,70 @@
+package huff
+
+import "github.com/dgryski/go-bitstream"
+
+// Filter transforms a stream of symbols one symbol at a time.
+type Filter interface {
+	Apply(s uint32) (uint32, error)
+}
+
+// MTF is a move-to-front transform over the alphabet 0..n-1.
+type MTF struct {
+	list []uint32
+}
+
+func NewMTF(n int) *MTF {
+	list := make([]uint32, n)
+	for i := range list {
+		list[i] = uint32(i)
+	}
+	return &MTF{list: list}
+}
+
+// Apply returns the current position of s in the list and moves s to the front.
+func (m *MTF) Apply(s uint32) (uint32, error) {
+	for i, v := range m.list {
+		if v == s {
+			copy(m.list[1:i+1], m.list[:i])
+			m.list[0] = s
+			return uint32(i), nil
+		}
+	}
+	return 0, ErrSymbolRange
+}
+
+// InverseMTF undoes an MTF over the same alphabet.
+type InverseMTF struct {
+	list []uint32
+}
+
+func NewInverseMTF(n int) *InverseMTF {
+	return &InverseMTF{list: NewMTF(n).list}
+}
+
+// Apply returns the symbol at position i in the list and moves it to the front.
+func (m *InverseMTF) Apply(i uint32) (uint32, error) {
+	if i >= uint32(len(m.list)) {
+		return 0, ErrSymbolRange
+	}
+	s := m.list[i]
+	copy(m.list[1:i+1], m.list[:i])
+	m.list[0] = s
+	return s, nil
+}
+
+// DecodeFiltered reads symbols from br until EOF, passing each through f.
+func (d *Decoder) DecodeFiltered(br *bitstream.BitReader, f Filter) ([]uint32, error) {
+	var out []uint32
+	_, err := d.decode(br, func(s uint32, _ int) error {
+		if s == EOF {
+			return nil
+		}
+		s, err := f.Apply(s)
+		if err != nil {
+			return err
+		}
+		out = append(out, s)
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,56 @@
+package huff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+func TestDecodeFiltered(t *testing.T) {
+
+	const n = 16
+
+	var syms []uint32
+	for i := 0; i < 400; i++ {
+		// runs of repeated symbols, which MTF turns into runs of zeros
+		syms = append(syms, uint32((i/5*7)%n))
+	}
+
+	mtf := NewMTF(n)
+	counts := make([]int, n)
+	ranks := make([]uint32, len(syms))
+	for i, s := range syms {
+		r, err := mtf.Apply(s)
+		if err != nil {
+			t.Fatalf("MTF(%d): %v", s, err)
+		}
+		ranks[i] = r
+		counts[r]++
+	}
+
+	if counts[0] < len(syms)*3/4 {
+		t.Errorf("MTF produced only %d zeros", counts[0])
+	}
+
+	e := NewEncoder(counts)
+	data := encodeSymbols(e, ranks)
+
+	got, err := e.Decoder().DecodeFiltered(bitstream.NewReader(bytes.NewReader(data)), NewInverseMTF(n))
+	if err != nil {
+		t.Fatalf("DecodeFiltered: %v", err)
+	}
+
+	if len(got) != len(syms) {
+		t.Fatalf("got %d symbols, want %d", len(got), len(syms))
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Fatalf("symbol %d: got %d, want %d", i, got[i], syms[i])
+		}
+	}
+
+	if _, err := NewInverseMTF(4).Apply(4); err != ErrSymbolRange {
+		t.Errorf("out of range: err = %v, want %v", err, ErrSymbolRange)
+	}
+}
@@ -3,11 +3,21 @@ package huff
 
 import (
 	"bytes"
+	"compress/gzip"
 	"container/heap"
 	"encoding/binary"
 	"errors"
+	"hash/crc32"
+	"hash/fnv"
 	"io"
+	"iter"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/dgryski/go-bitstream"
 )
@@ -18,6 +28,7 @@ type symbol struct {
 	s      uint32
 	code   uint32
 	length int
+	weight int // the count the code was built from, if known
 }
 
 type codebook []symbol
@@ -31,6 +42,10 @@ func (c codebook) calculateCodes() (symptrs, []uint32) {
 	}
 	sort.Sort(sptrs)
 
+	if len(sptrs) == 0 {
+		return nil, nil
+	}
+
 	var code uint32
 	numl := make([]uint32, sptrs[len(sptrs)-1].length+1)
 	prevlen := -1
@@ -47,6 +62,38 @@ func (c codebook) calculateCodes() (symptrs, []uint32) {
 	return sptrs, numl
 }
 
+// validate checks that the code lengths describe a canonical prefix code:
+// at least one symbol is present, no code is longer than 32 bits, and no
+// length has more symbols than there is code space left for it.
+func (c codebook) validate() error {
+	var numl [33]uint64
+	var n int
+	for i := range c {
+		if c[i].length < 0 || c[i].length > 32 {
+			return ErrInvalidCodebook
+		}
+		if c[i].length != 0 {
+			numl[c[i].length]++
+			n++
+		}
+	}
+
+	if n == 0 {
+		return ErrInvalidCodebook
+	}
+
+	// code is the first canonical code of length l
+	var code uint64
+	for l := 1; l < len(numl); l++ {
+		if code+numl[l] > 1<<uint(l) {
+			return ErrInvalidCodebook
+		}
+		code = (code + numl[l]) << 1
+	}
+
+	return nil
+}
+
 func (c codebook) MarshalBinary() ([]byte, error) {
 	var b []byte
 
@@ -66,14 +113,19 @@ func (c codebook) MarshalBinary() ([]byte, error) {
 var ErrInvalidCodebook = errors.New("huff: invalid codebook")
 
 func (c *codebook) UnmarshalBinary(data []byte) error {
-	r := bytes.NewReader(data)
+	return c.readFrom(bytes.NewReader(data))
+}
 
+func (c *codebook) readFrom(r *bytes.Reader) error {
 	l, err := binary.ReadUvarint(r)
 	if err != nil {
 		return ErrInvalidCodebook
 	}
 
-	// TODO(dgryski): sanity check `l`
+	// every length takes at least one byte
+	if l > uint64(r.Len()) {
+		return ErrInvalidCodebook
+	}
 
 	*c = make(codebook, l)
 
@@ -88,18 +140,64 @@ func (c *codebook) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// Codebooks in the versioned format start with codebookMarker, which can't
+// start a plain codebook since that would have no symbols, and then the
+// format version.
+const (
+	codebookMarker = 0
+
+	// codebookCounted is a codebook followed by the number of symbols, not
+	// counting EOF, in the stream it describes
+	codebookCounted = 1
+)
+
+// countedCodebook is a codebook and the number of symbols in the stream it
+// describes, or -1 if that isn't known.  It reads both the plain and the
+// counted format.
+type countedCodebook struct {
+	codebook
+	total int64
+}
+
+func (c *countedCodebook) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != codebookMarker {
+		c.total = -1
+		return c.codebook.UnmarshalBinary(data)
+	}
+
+	if len(data) < 2 || data[1] != codebookCounted {
+		return ErrInvalidCodebook
+	}
+	r := bytes.NewReader(data[2:])
+
+	if err := c.codebook.readFrom(r); err != nil {
+		return err
+	}
+
+	total, err := binary.ReadUvarint(r)
+	if err != nil || total > math.MaxInt64 {
+		return ErrInvalidCodebook
+	}
+	c.total = int64(total)
+
+	return nil
+}
+
 type node struct {
 	weight int
 	child  [2]*node
 	leaf   bool
-	sym    uint32
+	sym    uint32 // for internal nodes, the smallest symbol below it
 }
 
 type nodes []node
 
-func (n nodes) Len() int            { return len(n) }
-func (n nodes) Swap(i, j int)       { n[i], n[j] = n[j], n[i] }
-func (n nodes) Less(i, j int) bool  { return n[i].weight < n[j].weight }
+func (n nodes) Len() int      { return len(n) }
+func (n nodes) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n nodes) Less(i, j int) bool {
+	// break ties by symbol so the tree doesn't depend on the heap's internal order
+	return n[i].weight < n[j].weight || n[i].weight == n[j].weight && n[i].sym < n[j].sym
+}
 func (n *nodes) Push(x interface{}) { *n = append(*n, x.(node)) }
 
 func (n *nodes) Pop() interface{} {
@@ -114,6 +212,9 @@ type symptrs []*symbol
 
 func (s symptrs) Len() int      { return len(s) }
 func (s symptrs) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less orders by length then symbol, a total order since symbols are unique,
+// so sorting yields the same canonical codes for any input order.
 func (s symptrs) Less(i, j int) bool {
 	return s[i].length < s[j].length || s[i].length == s[j].length && s[i].s < s[j].s
 }
@@ -123,6 +224,13 @@ type Encoder struct {
 	m    codebook
 	sym  symptrs
 	numl []uint32
+
+	// alias maps symbols to the symbol whose code they share, see NewEncoderAliased
+	alias map[uint32]uint32
+
+	// sparse is set if m holds only the symbols with a code, in symbol order,
+	// rather than an entry for every symbol up to EOF
+	sparse bool
 }
 
 func NewEncoder(counts []int) *Encoder {
@@ -134,28 +242,388 @@ func NewEncoder(counts []int) *Encoder {
 		}
 	}
 
+	return buildEncoder(n, uint32(len(counts)))
+}
+
+var ErrNoSymbols = errors.New("huff: no symbols")
+
+// NewEncoders builds an encoder for each table of counts, in order.  It
+// returns ErrNoSymbols if any table has no non-zero counts.
+func NewEncoders(tables ...[]int) ([]*Encoder, error) {
+	encs := make([]*Encoder, len(tables))
+	for i, counts := range tables {
+		var found bool
+		for _, v := range counts {
+			if v != 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrNoSymbols
+		}
+		encs[i] = NewEncoder(counts)
+	}
+	return encs, nil
+}
+
+// SymCount is a symbol and the number of times it occurs.
+type SymCount struct {
+	Sym   uint32
+	Count int
+}
+
+var ErrDuplicateSymbol = errors.New("huff: duplicate symbol")
+
+// NewEncoderFromPairs builds an encoder from (symbol, count) pairs.  It
+// produces the same codebook as NewEncoder on the equivalent dense counts,
+// but only holds entries for the symbols with a non-zero count, so the
+// memory it needs doesn't depend on the largest symbol.  CodebookBytes still
+// writes a length for every symbol up to EOF.
+// It returns ErrSymbolRange for the symbols 0xfffffffe and 0xffffffff, as
+// EOF must come after the highest symbol and can't be EOF's own value.
+func NewEncoderFromPairs(pairs []SymCount) (*Encoder, error) {
+	if !sort.SliceIsSorted(pairs, func(i, j int) bool { return pairs[i].Sym < pairs[j].Sym }) {
+		pairs = append([]SymCount(nil), pairs...)
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Sym < pairs[j].Sym })
+	}
+
+	var n nodes
+	var eof uint32
+
+	for i, p := range pairs {
+		if i > 0 && p.Sym == pairs[i-1].Sym {
+			return nil, ErrDuplicateSymbol
+		}
+		if p.Sym >= math.MaxUint32-1 {
+			// no room left for EOF after it
+			return nil, ErrSymbolRange
+		}
+		if p.Count != 0 {
+			heap.Push(&n, node{weight: p.Count, leaf: true, sym: p.Sym})
+		}
+		eof = p.Sym + 1
+	}
+
+	// one more for EOF
+	heap.Push(&n, node{weight: 0, leaf: true, sym: eof})
+
+	root := buildTree(n)
+	m := leaves(root, 0, nil)
+	sort.Slice(m, func(i, j int) bool { return m[i].s < m[j].s })
+	if root.leaf {
+		// only EOF, which still needs one bit
+		m[0].length = 1
+	}
+
+	sptrs, numl := m.calculateCodes()
+
+	return &Encoder{eof: eof, m: m, sym: sptrs, numl: numl, sparse: true}, nil
+}
+
+// buildEncoder adds the EOF leaf to the heap n and builds the encoder from the resulting tree
+func buildEncoder(n nodes, eof uint32) *Encoder {
 	// one more for EOF
-	eof := uint32(len(counts))
 	heap.Push(&n, node{weight: 0, leaf: true, sym: eof})
 
+	m := make(codebook, eof+1)
+	root := buildTree(n)
+	walk(root, 0, m)
+	if root.leaf {
+		// only EOF, which still needs one bit
+		m[root.sym].length = 1
+	}
+
+	sptrs, numl := m.calculateCodes()
+
+	return &Encoder{eof: eof, m: m, sym: sptrs, numl: numl}
+}
+
+// buildTree merges the nodes in the heap n into a single huffman tree
+func buildTree(n nodes) *node {
 	for n.Len() > 1 {
 		n1 := heap.Pop(&n).(node)
 		n2 := heap.Pop(&n).(node)
-		heap.Push(&n, node{weight: n1.weight + n2.weight, child: [2]*node{&n2, &n1}})
+		sym := n1.sym
+		if n2.sym < sym {
+			sym = n2.sym
+		}
+		heap.Push(&n, node{weight: n1.weight + n2.weight, child: [2]*node{&n2, &n1}, sym: sym})
 	}
+	return &n[0]
+}
 
-	m := make(codebook, eof+1)
-	walk(&n[0], 0, m)
+// NewEncoderNoEOF builds an encoder with no EOF symbol, for streams whose
+// length is known from elsewhere.  Writing EOF returns ErrUnknownSymbol, and
+// the codebook must be read back with NewDecoderNoEOF.
+func NewEncoderNoEOF(counts []int) *Encoder {
+	var n nodes
+	for i, v := range counts {
+		if v != 0 {
+			heap.Push(&n, node{weight: v, leaf: true, sym: uint32(i)})
+		}
+	}
+
+	m := make(codebook, len(counts))
+	if n.Len() != 0 {
+		root := buildTree(n)
+		walk(root, 0, m)
+		if root.leaf {
+			// a lone symbol still needs one bit
+			m[root.sym].length = 1
+		}
+	}
 
 	sptrs, numl := m.calculateCodes()
 
-	return &Encoder{eof: eof, m: m, sym: sptrs, numl: numl}
+	// no symbol has the index one past the end of the codebook
+	return &Encoder{eof: uint32(len(counts)), m: m, sym: sptrs, numl: numl}
+}
+
+// NewEncoderFromLengths builds an encoder from the code length of each
+// symbol, with zero for unused symbols.  As in DEFLATE, the lengths must
+// form a complete prefix code, except that a single code of length 1 is
+// allowed.  Every entry is a data symbol: like one from NewEncoderNoEOF, the
+// encoder has no EOF, and its codebook must be read with NewDecoderNoEOF.
+func NewEncoderFromLengths(lengths []int) (*Encoder, error) {
+	m := make(codebook, len(lengths))
+	var n int
+	var kraft uint64
+	for i, l := range lengths {
+		m[i] = symbol{s: uint32(i), length: l}
+		if l > 0 && l <= 32 {
+			kraft += 1 << uint(32-l)
+			n++
+		}
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	if kraft != 1<<32 && !(n == 1 && kraft == 1<<31) {
+		return nil, ErrInvalidCodebook
+	}
+
+	sptrs, numl := m.calculateCodes()
+
+	// no symbol has the index one past the end of the codebook
+	return &Encoder{eof: uint32(len(lengths)), m: m, sym: sptrs, numl: numl}, nil
+}
+
+// NewEncoderOrFixed is like NewEncoder, but if counts has no non-zero
+// entries, or would need codes longer than 32 bits, it returns a fixed byte
+// encoder instead: bytes 0-254 get 8 bit codes, and byte 255 and EOF 9 bits.
+func NewEncoderOrFixed(counts []int) *Encoder {
+	for _, v := range counts {
+		if v != 0 {
+			if e := NewEncoder(counts); len(e.numl)-1 <= 32 {
+				return e
+			}
+			break
+		}
+	}
+
+	m := make(codebook, 257)
+	for i := range m {
+		m[i] = symbol{s: uint32(i), length: 8}
+	}
+	m[255].length = 9
+	m[256].length = 9
+
+	sptrs, numl := m.calculateCodes()
+
+	return &Encoder{eof: 256, m: m, sym: sptrs, numl: numl}
+}
+
+// NewEncoderFloor is like NewEncoder, but raises any non-zero count below
+// minFreq up to minFreq first, bounding the length of the longest code.
+func NewEncoderFloor(counts []int, minFreq int) *Encoder {
+	floored := make([]int, len(counts))
+	for i, v := range counts {
+		if v != 0 && v < minFreq {
+			v = minFreq
+		}
+		floored[i] = v
+	}
+	return NewEncoder(floored)
+}
+
+var ErrSampleSize = errors.New("huff: sample size must be positive")
+
+// NewEncoderReservoir builds a byte encoder from a uniform sample of up to
+// sampleSize bytes of r, chosen by reservoir sampling in a single pass.
+// Bytes that occur in r but not in the sample are given a count of one, so
+// every byte of r can still be encoded.  The sample is drawn from a fixed
+// seed, so the same input always gives the same codebook.
+func NewEncoderReservoir(r io.Reader, sampleSize int) (*Encoder, error) {
+	if sampleSize <= 0 {
+		return nil, ErrSampleSize
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	sample := make([]byte, 0, sampleSize)
+	var seen [256]bool
+	var n int64
+
+	buf := make([]byte, 32*1024)
+	for {
+		k, err := r.Read(buf)
+		for _, b := range buf[:k] {
+			seen[b] = true
+			if len(sample) < sampleSize {
+				sample = append(sample, b)
+			} else if j := rnd.Int63n(n + 1); j < int64(sampleSize) {
+				sample[j] = b
+			}
+			n++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make([]int, 256)
+	for _, b := range sample {
+		counts[b]++
+	}
+	for b, ok := range seen {
+		if ok && counts[b] == 0 {
+			counts[b] = 1
+		}
+	}
+
+	return NewEncoder(counts), nil
+}
+
+var ErrAliasChain = errors.New("huff: alias target is itself an alias")
+
+// NewEncoderAliased is like NewEncoder, but first adds the count of each
+// symbol in aliases to the count of the symbol it maps to.  Writing an
+// aliased symbol writes its target's code, so it decodes as the target: the
+// distinction between them is lost.  Targets must be in range and must not
+// themselves be aliased.  DecodeAliased gives the same result for streams
+// written without aliasing.
+func NewEncoderAliased(counts []int, aliases map[uint32]uint32) (*Encoder, error) {
+	merged := append([]int(nil), counts...)
+	for s, t := range aliases {
+		if s >= uint32(len(counts)) || t >= uint32(len(counts)) {
+			return nil, ErrSymbolRange
+		}
+		if _, ok := aliases[t]; ok {
+			return nil, ErrAliasChain
+		}
+		merged[t] += merged[s]
+	}
+	for s := range aliases {
+		merged[s] = 0
+	}
+
+	e := NewEncoder(merged)
+	e.alias = make(map[uint32]uint32, len(aliases))
+	for s, t := range aliases {
+		e.alias[s] = t
+	}
+
+	return e, nil
+}
+
+// NewEncoderClamped is like NewEncoder, but first clamps every count to the
+// given percentile (0-100) of the non-zero counts, flattening the codebook.
+func NewEncoderClamped(counts []int, percentile float64) *Encoder {
+	var nz []int
+	for _, v := range counts {
+		if v != 0 {
+			nz = append(nz, v)
+		}
+	}
+
+	if len(nz) == 0 {
+		return NewEncoder(counts)
+	}
+
+	sort.Ints(nz)
+
+	// nearest-rank percentile
+	rank := int(math.Ceil(percentile/100*float64(len(nz)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(nz) {
+		rank = len(nz) - 1
+	}
+	limit := nz[rank]
+
+	clamped := make([]int, len(counts))
+	for i, v := range counts {
+		if v > limit {
+			v = limit
+		}
+		clamped[i] = v
+	}
+	return NewEncoder(clamped)
+}
+
+// Entropy returns the Shannon entropy, in bits per symbol, of the
+// distribution given by counts.
+func Entropy(counts []int) float64 {
+	var total float64
+	for _, v := range counts {
+		total += float64(v)
+	}
+
+	var h float64
+	for _, v := range counts {
+		if v != 0 {
+			p := float64(v) / total
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+var ErrBudget = errors.New("huff: bit budget not achievable")
+
+// NewEncoderBudget returns the encoder for counts if its average code length
+// is within targetBitsPerSymbol, and ErrBudget otherwise.  Since a huffman
+// code is optimal, no other prefix code meets a budget this one misses; a
+// budget below the entropy of counts can't be met by any lossless code.
+func NewEncoderBudget(counts []int, targetBitsPerSymbol float64) (*Encoder, error) {
+	if Entropy(counts) > targetBitsPerSymbol {
+		return nil, ErrBudget
+	}
+
+	e := NewEncoder(counts)
+
+	var bits, total float64
+	for i, v := range counts {
+		bits += float64(v) * float64(e.SymbolLen(uint32(i)))
+		total += float64(v)
+	}
+
+	if total != 0 && bits/total > targetBitsPerSymbol {
+		return nil, ErrBudget
+	}
+
+	return e, nil
+}
+
+// leaves appends the leaves below n to m, in tree order
+func leaves(n *node, depth int, m codebook) codebook {
+	if n.leaf {
+		return append(m, symbol{s: n.sym, length: depth, weight: n.weight})
+	}
+	m = leaves(n.child[0], depth+1, m)
+	return leaves(n.child[1], depth+1, m)
 }
 
 func walk(n *node, depth int, m codebook) {
 
 	if n.leaf {
-		m[n.sym] = symbol{s: n.sym, length: depth}
+		m[n.sym] = symbol{s: n.sym, length: depth, weight: n.weight}
 		return
 	}
 
@@ -163,17 +631,65 @@ func walk(n *node, depth int, m codebook) {
 	walk(n.child[1], depth+1, m)
 }
 
-func (e *Encoder) SymbolLen(s uint32) int {
-
+// index returns the codebook entry that holds the code for s: EOF's entry
+// for EOF, and the target's entry for an aliased symbol
+func (e *Encoder) index(s uint32) uint32 {
 	if s == EOF {
-		s = e.eof
+		return e.eof
+	}
+	if t, ok := e.alias[s]; ok {
+		return t
+	}
+	return s
+}
+
+// entry returns the codebook entry for s, after resolving it with index, or
+// nil if there is none
+func (e *Encoder) entry(s uint32) *symbol {
+	s = e.index(s)
+
+	if e.sparse {
+		i := sort.Search(len(e.m), func(i int) bool { return e.m[i].s >= s })
+		if i == len(e.m) || e.m[i].s != s {
+			return nil
+		}
+		return &e.m[i]
 	}
 
 	if s >= uint32(len(e.m)) {
+		return nil
+	}
+	return &e.m[s]
+}
+
+// each calls fn with every symbol up to and including EOF, in order, and its
+// codebook entry; symbols with no code have a zero entry
+func (e *Encoder) each(fn func(s uint32, sym symbol)) {
+	if !e.sparse {
+		for i, sym := range e.m {
+			fn(uint32(i), sym)
+		}
+		return
+	}
+
+	var next uint32
+	for _, sym := range e.m {
+		for ; next < sym.s; next++ {
+			fn(next, symbol{})
+		}
+		fn(sym.s, sym)
+		next++
+	}
+}
+
+func (e *Encoder) SymbolLen(s uint32) int {
+
+	sym := e.entry(s)
+	if sym == nil {
 		return 0
 	}
 
-	return e.m[s].length
+	return sym.length
 }
 
 func (e *Encoder) Writer(w io.Writer) *Writer {
@@ -181,83 +697,704 @@ func (e *Encoder) Writer(w io.Writer) *Writer {
 }
 
 func (e *Encoder) CodebookBytes() []byte {
-	b, _ := e.m.MarshalBinary()
+	if !e.sparse {
+		b, _ := e.m.MarshalBinary()
+		return b
+	}
+
+	// the same as MarshalBinary of the dense codebook, with EOF last
+	b := binary.AppendUvarint(nil, uint64(e.eof)+1)
+	e.each(func(_ uint32, sym symbol) {
+		b = binary.AppendUvarint(b, uint64(sym.length))
+	})
 	return b
 }
 
-type Writer struct {
-	e *Encoder
-	*bitstream.BitWriter
-	closed bool
+// CodebookBytesCounted returns the codebook in the versioned format, recording
+// total, the number of symbols in the stream it will be used for.  Decoders
+// read from it check that count; see NewDecoderCounted.
+func (e *Encoder) CodebookBytesCounted(total int) []byte {
+	b := append([]byte{codebookMarker, codebookCounted}, e.CodebookBytes()...)
+	return binary.AppendUvarint(b, uint64(total))
 }
 
-var ErrUnknownSymbol = errors.New("huff: unknown symbol")
-
-func (w *Writer) WriteSymbol(s uint32) (int, error) {
+// EOFOverheadBits returns how many more bits the encoder needs for a message
+// with the given counts than an optimal code with no EOF symbol would.  For
+// an encoder built from counts, this is the cost of reserving EOF.
+func (e *Encoder) EOFOverheadBits(counts []int) int64 {
+	return e.EncodedBits(counts) - NewEncoderNoEOF(counts).EncodedBits(counts)
+}
 
-	if s == EOF {
-		s = w.e.eof
+// CommonPrefixLen returns the number of leading bits shared by the codes for a and b.
+func (e *Encoder) CommonPrefixLen(a, b uint32) int {
+	la, lb := e.SymbolLen(a), e.SymbolLen(b)
+	if la == 0 || lb == 0 {
+		return 0
 	}
 
-	if s > w.e.eof {
-		return 0, ErrUnknownSymbol
+	n := la
+	if lb < n {
+		n = lb
 	}
 
-	sym := w.e.m[s]
-
-	w.WriteBits(uint64(sym.code), sym.length)
+	ca := e.entry(a).code >> uint(la-n)
+	cb := e.entry(b).code >> uint(lb-n)
 
-	return sym.length, nil
+	return n - bits.Len32(ca^cb)
 }
 
-func (w *Writer) Close() {
-	if w.closed {
-		return
-	}
-	w.Flush(bitstream.Zero)
-}
+var ErrShortSymbols = errors.New("huff: not enough symbols")
 
-type Decoder struct {
-	eof  uint32
-	numl []uint32
-	sym  symptrs
-}
+// BitOffsetAfter returns the bit offset in the encoded stream just after the
+// first n of syms have been written.
+func (e *Encoder) BitOffsetAfter(syms []uint32, n int) (int64, error) {
+	if n < 0 || n > len(syms) {
+		return 0, ErrShortSymbols
+	}
 
-func (e *Encoder) Decoder() *Decoder {
-	return &Decoder{
-		eof:  e.eof,
-		numl: e.numl,
-		sym:  e.sym,
+	var off int64
+	for _, s := range syms[:n] {
+		l := e.SymbolLen(s)
+		if l == 0 {
+			return 0, ErrUnknownSymbol
+		}
+		off += int64(l)
 	}
+	return off, nil
 }
 
-func NewDecoder(cb []byte) (*Decoder, error) {
-	var c codebook
-	if err := c.UnmarshalBinary(cb); err != nil {
-		return nil, err
+// ExpectedBitsPerSymbol returns the average code length, weighted by the counts
+// the encoder was built from.
+func (e *Encoder) ExpectedBitsPerSymbol() float64 {
+	var bits, total float64
+	for _, sym := range e.sym {
+		bits += float64(sym.weight) * float64(sym.length)
+		total += float64(sym.weight)
 	}
 
-	sptrs, numl := c.calculateCodes()
+	if total == 0 {
+		return 0
+	}
 
-	eof := uint32(len(c)) - 1
-	return &Decoder{
-		eof:  eof,
-		numl: numl,
-		sym:  sptrs,
-	}, nil
+	return bits / total
 }
 
-func (d *Decoder) ReadSymbol(br *bitstream.BitReader) (uint32, error) {
-	var offset uint32
-	var code uint32
-
-	for i := 0; i < len(d.numl); i++ {
-		b, err := br.ReadBit()
-		if err != nil {
-			return 0, err
+// Gini returns the Gini coefficient of the counts the encoder was built from,
+// over the symbols that have a code, not counting EOF.  It is 0 when every
+// symbol is equally likely and approaches 1 as the counts concentrate on a
+// single symbol, which is when a huffman code does best.
+func (e *Encoder) Gini() float64 {
+	var w []float64
+	for _, sym := range e.sym {
+		if sym.s != e.eof {
+			w = append(w, float64(sym.weight))
 		}
+	}
+	sort.Float64s(w)
 
-		code <<= 1
+	var sum, total float64
+	n := float64(len(w))
+	for i, v := range w {
+		sum += (2*float64(i+1) - n - 1) * v
+		total += v
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return sum / (n * total)
+}
+
+// RunLengthCandidates returns, in increasing order, the symbols making up
+// more than threshold (0-1) of the counts the encoder was built from.  A
+// huffman code spends at least a bit on each of them, so long runs of these
+// symbols are better handled by a run-length stage before huffman coding.
+func (e *Encoder) RunLengthCandidates(threshold float64) []uint32 {
+	var total int
+	for _, sym := range e.sym {
+		total += sym.weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	var syms []uint32
+	for _, sym := range e.sym {
+		if sym.s != e.eof && float64(sym.weight) > threshold*float64(total) {
+			syms = append(syms, sym.s)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i] < syms[j] })
+	return syms
+}
+
+// BalanceFactor returns the average depth of the leaves of the code tree,
+// EOF included, divided by the log2 of their number, the average depth of a
+// perfectly balanced tree.  It is at least 1, and close to 1 when a fixed
+// length code would do about as well; skewed counts make it larger.
+func (e *Encoder) BalanceFactor() float64 {
+	if len(e.sym) < 2 {
+		return 1
+	}
+
+	var depth float64
+	for _, sym := range e.sym {
+		depth += float64(sym.length)
+	}
+
+	n := float64(len(e.sym))
+	return depth / n / math.Log2(n)
+}
+
+// Redundancy returns how many more bits per symbol the encoder spends on a
+// message with the given counts than the entropy of counts.  For counts the
+// encoder was built from, this is ExpectedBitsPerSymbol() - Entropy(counts).
+func (e *Encoder) Redundancy(counts []int) float64 {
+	var bits, total float64
+	for i, v := range counts {
+		bits += float64(v) * float64(e.SymbolLen(uint32(i)))
+		total += float64(v)
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return bits/total - Entropy(counts)
+}
+
+// LengthHistogram returns the number of codes of each length, indexed by
+// length, used to encode a message with the given counts, including EOF.
+func (e *Encoder) LengthHistogram(counts []int) []int64 {
+	hist := make([]int64, len(e.numl))
+	if l := e.SymbolLen(EOF); l != 0 {
+		hist[l]++
+	}
+	for i, v := range counts {
+		if l := e.SymbolLen(uint32(i)); l != 0 {
+			hist[l] += int64(v)
+		}
+	}
+	return hist
+}
+
+// PruningCandidates ranks the symbols of a message with the given counts by
+// the number of bits they contribute to it, and returns the symbols outside
+// the top keep, in increasing symbol order.
+func (e *Encoder) PruningCandidates(counts []int, keep int) []uint32 {
+	var syms []uint32
+	for i, v := range counts {
+		if v != 0 {
+			syms = append(syms, uint32(i))
+		}
+	}
+
+	if keep >= len(syms) {
+		return nil
+	}
+	if keep < 0 {
+		keep = 0
+	}
+
+	bits := func(s uint32) int64 { return int64(counts[s]) * int64(e.SymbolLen(s)) }
+	sort.SliceStable(syms, func(i, j int) bool { return bits(syms[i]) > bits(syms[j]) })
+
+	drop := syms[keep:]
+	sort.Slice(drop, func(i, j int) bool { return drop[i] < drop[j] })
+	return drop
+}
+
+// ByteAlignment reports, for each of syms, whether the encoded stream is
+// byte aligned just after it is written.
+func (e *Encoder) ByteAlignment(syms []uint32) []bool {
+	aligned := make([]bool, len(syms))
+	var off int
+	for i, s := range syms {
+		off += e.SymbolLen(s)
+		aligned[i] = off%8 == 0
+	}
+	return aligned
+}
+
+// IsByteAligned returns whether encoding syms takes a whole number of bytes.
+func (e *Encoder) IsByteAligned(syms []uint32) bool {
+	var off int
+	for _, s := range syms {
+		off += e.SymbolLen(s)
+	}
+	return off%8 == 0
+}
+
+// CodebookSize returns the length in bytes of the serialized codebook.
+func (e *Encoder) CodebookSize() int {
+	return len(e.CodebookBytes())
+}
+
+// EncodedBits returns the number of bits needed to encode a message with the
+// given symbol counts, including the trailing EOF.
+func (e *Encoder) EncodedBits(counts []int) int64 {
+	bits := int64(e.SymbolLen(EOF))
+	for i, v := range counts {
+		bits += int64(v) * int64(e.SymbolLen(uint32(i)))
+	}
+	return bits
+}
+
+// TransmissionOverhead returns the size of the codebook relative to the size
+// of a payload with the given symbol counts.
+func (e *Encoder) TransmissionOverhead(counts []int) float64 {
+	return float64(e.CodebookSize()*8) / float64(e.EncodedBits(counts))
+}
+
+// BreakEvenSymbols returns the message length, in symbols distributed like
+// counts, above which sending the codebook, the huffman coded symbols, and
+// EOF takes fewer bits than sending the symbols raw in the narrowest fixed
+// width that holds them all.  It returns -1 if the huffman code never wins.
+func (e *Encoder) BreakEvenSymbols(counts []int) int {
+	width := int64(bits.Len(uint(len(counts) - 1)))
+	if width == 0 {
+		width = 1
+	}
+
+	var coded, total int64
+	for i, v := range counts {
+		coded += int64(v) * int64(e.SymbolLen(uint32(i)))
+		total += int64(v)
+	}
+
+	// per symbol saving is (width*total - coded) / total
+	saving := width*total - coded
+	if total == 0 || saving <= 0 {
+		return -1
+	}
+
+	overhead := int64(e.CodebookSize()*8 + e.SymbolLen(EOF))
+	return int(overhead * total / saving)
+}
+
+// Suboptimality is a symbol whose assigned code length differs from the
+// length an optimal codebook for the observed counts would give it.
+type Suboptimality struct {
+	Sym         uint32
+	AssignedLen int
+	IdealLen    int
+}
+
+// Suboptimalities compares the encoder's code lengths against those of an
+// optimal codebook built from counts, returning the symbols that differ.
+func (e *Encoder) Suboptimalities(counts []int) []Suboptimality {
+	ideal := NewEncoder(counts)
+
+	var subs []Suboptimality
+	for i, v := range counts {
+		if v == 0 {
+			continue
+		}
+		s := uint32(i)
+		if al, il := e.SymbolLen(s), ideal.SymbolLen(s); al != il {
+			subs = append(subs, Suboptimality{Sym: s, AssignedLen: al, IdealLen: il})
+		}
+	}
+
+	return subs
+}
+
+// CodebookHash returns a hash of the symbols and code lengths in the
+// codebook, and of any aliases.  Encoders that assign identical codes hash
+// equal.
+func (e *Encoder) CodebookHash() uint64 {
+	h := fnv.New64a()
+
+	var vbuf [binary.MaxVarintLen32]byte
+
+	l := binary.PutUvarint(vbuf[:], uint64(e.eof))
+	h.Write(vbuf[:l])
+
+	for _, sym := range e.sym {
+		l := binary.PutUvarint(vbuf[:], uint64(sym.s))
+		h.Write(vbuf[:l])
+		l = binary.PutUvarint(vbuf[:], uint64(sym.length))
+		h.Write(vbuf[:l])
+	}
+
+	if len(e.alias) != 0 {
+		l := binary.PutUvarint(vbuf[:], uint64(len(e.alias)))
+		h.Write(vbuf[:l])
+
+		aliases := make([]uint32, 0, len(e.alias))
+		for s := range e.alias {
+			aliases = append(aliases, s)
+		}
+		sort.Slice(aliases, func(i, j int) bool { return aliases[i] < aliases[j] })
+
+		for _, s := range aliases {
+			l := binary.PutUvarint(vbuf[:], uint64(s))
+			h.Write(vbuf[:l])
+			l = binary.PutUvarint(vbuf[:], uint64(e.alias[s]))
+			h.Write(vbuf[:l])
+		}
+	}
+
+	return h.Sum64()
+}
+
+type Writer struct {
+	e *Encoder
+	*bitstream.BitWriter
+	bits   int64
+	closed bool
+}
+
+var ErrUnknownSymbol = errors.New("huff: unknown symbol")
+
+func (w *Writer) WriteSymbol(s uint32) (int, error) {
+
+	if s != EOF && s >= w.e.eof {
+		return 0, ErrUnknownSymbol
+	}
+
+	sym := w.e.entry(s)
+	if sym == nil || sym.length == 0 {
+		return 0, ErrUnknownSymbol
+	}
+
+	w.WriteBits(uint64(sym.code), sym.length)
+	w.bits += int64(sym.length)
+
+	return sym.length, nil
+}
+
+func (w *Writer) Close() {
+	w.CloseN()
+}
+
+// CloseN flushes the writer to a byte boundary and returns the number of zero
+// padding bits that were added after the symbols written with WriteSymbol.
+func (w *Writer) CloseN() (padBits int, err error) {
+	if w.closed {
+		return 0, nil
+	}
+	w.closed = true
+	padBits = int((8 - w.bits%8) % 8)
+	return padBits, w.Flush(bitstream.Zero)
+}
+
+type Decoder struct {
+	eof  uint32
+	numl []uint32
+	sym  symptrs
+
+	// total is the expected number of symbols in the stream, or -1
+	total int64
+}
+
+func (e *Encoder) Decoder() *Decoder {
+	return &Decoder{
+		eof:   e.eof,
+		numl:  e.numl,
+		sym:   e.sym,
+		total: -1,
+	}
+}
+
+// NewDecoder reads a codebook written by CodebookBytes or
+// CodebookBytesCounted.  If it records a symbol count, decoding checks it as
+// described for NewDecoderCounted.
+func NewDecoder(cb []byte) (*Decoder, error) {
+	var c countedCodebook
+	if err := c.UnmarshalBinary(cb); err != nil {
+		return nil, err
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	d := newDecoder(c.codebook)
+	d.total = c.total
+	return d, nil
+}
+
+// newDecoder builds a decoder for the validated codebook c
+func newDecoder(c codebook) *Decoder {
+	sptrs, numl := c.calculateCodes()
+
+	eof := uint32(len(c)) - 1
+	return &Decoder{
+		eof:   eof,
+		numl:  numl,
+		sym:   sptrs,
+		total: -1,
+	}
+}
+
+// NewDecoderMmap reads the codebook cb, typically a memory-mapped file, in
+// place. Unlike NewDecoder it never materializes a table entry per symbol:
+// the lengths are walked twice, once to count them and once to place the
+// symbols with a non-zero length directly in canonical order, so the heap
+// cost is proportional to the symbols in use rather than the alphabet.
+//
+// The returned decoder does not retain cb; it may be unmapped as soon as
+// NewDecoderMmap returns.  cb must not be modified while the call is running.
+func NewDecoderMmap(cb []byte) (*Decoder, error) {
+	l, off := binary.Uvarint(cb)
+	if off <= 0 || l == 0 || l > math.MaxUint32 || l > uint64(len(cb)-off) {
+		return nil, ErrInvalidCodebook
+	}
+	lengths := cb[off:]
+
+	// first pass: count the codes of each length
+	var numl [33]uint64
+	var n, maxlen int
+	p := lengths
+	for i := uint64(0); i < l; i++ {
+		clen, k := binary.Uvarint(p)
+		if k <= 0 || clen > 32 {
+			return nil, ErrInvalidCodebook
+		}
+		p = p[k:]
+		if clen != 0 {
+			numl[clen]++
+			n++
+			if int(clen) > maxlen {
+				maxlen = int(clen)
+			}
+		}
+	}
+
+	if n == 0 {
+		return nil, ErrInvalidCodebook
+	}
+
+	// next[l] is where the next symbol of length l goes, first[l] its code
+	var next, first [33]uint64
+	var idx, code uint64
+	for l := 1; l <= maxlen; l++ {
+		if code+numl[l] > 1<<uint(l) {
+			return nil, ErrInvalidCodebook
+		}
+		next[l], first[l] = idx, code
+		idx += numl[l]
+		code = (code + numl[l]) << 1
+	}
+	start := next
+
+	// second pass: symbols arrive in increasing order, so each length's
+	// slots fill in canonical order
+	syms := make([]symbol, n)
+	p = lengths
+	for i := uint32(0); uint64(i) < l; i++ {
+		clen, k := binary.Uvarint(p)
+		p = p[k:]
+		if clen == 0 {
+			continue
+		}
+		j := next[clen]
+		next[clen]++
+		syms[j] = symbol{s: i, code: uint32(first[clen] + j - start[clen]), length: int(clen)}
+	}
+
+	sptrs := make(symptrs, n)
+	for i := range syms {
+		sptrs[i] = &syms[i]
+	}
+
+	d := &Decoder{
+		eof:   uint32(l) - 1,
+		numl:  make([]uint32, maxlen+1),
+		sym:   sptrs,
+		total: -1,
+	}
+	for i := range d.numl {
+		d.numl[i] = uint32(numl[i])
+	}
+
+	return d, nil
+}
+
+// NewDecoderFromLengths builds a decoder from the code length of each
+// symbol, in order and with EOF last, as they arrive from lengths.  Only the
+// symbols with a code are kept, so the whole codebook is never held at once.
+func NewDecoderFromLengths(lengths iter.Seq[int]) (*Decoder, error) {
+	var used codebook
+	var n uint64
+	for l := range lengths {
+		if l < 0 || l > 32 || n > math.MaxUint32 {
+			return nil, ErrInvalidCodebook
+		}
+		if l != 0 {
+			used = append(used, symbol{s: uint32(n), length: l})
+		}
+		n++
+	}
+
+	if err := used.validate(); err != nil {
+		return nil, err
+	}
+
+	sptrs, numl := used.calculateCodes()
+
+	return &Decoder{
+		eof:   uint32(n) - 1,
+		numl:  numl,
+		sym:   sptrs,
+		total: -1,
+	}, nil
+}
+
+var (
+	ErrTruncated   = errors.New("huff: stream has fewer symbols than expected")
+	ErrSymbolCount = errors.New("huff: stream has more symbols than expected")
+)
+
+// NewDecoderCounted reads a codebook written by CodebookBytesCounted, and
+// returns ErrInvalidCodebook for one with no symbol count.  DecodeBytes, and
+// the other methods that decode a whole stream, return ErrTruncated or
+// ErrSymbolCount if the number of symbols decoded doesn't match the count.
+func NewDecoderCounted(cb []byte) (*Decoder, error) {
+	d, err := NewDecoder(cb)
+	if err != nil {
+		return nil, err
+	}
+	if d.total < 0 {
+		return nil, ErrInvalidCodebook
+	}
+	return d, nil
+}
+
+// NewDecoderNoEOF is like NewDecoder, but treats every entry of the codebook
+// as a data symbol rather than taking the last one as EOF.  It reads the
+// codebooks written by encoders from NewEncoderNoEOF.
+func NewDecoderNoEOF(cb []byte) (*Decoder, error) {
+	d, err := NewDecoder(cb)
+	if err != nil {
+		return nil, err
+	}
+	d.eof++
+	return d, nil
+}
+
+// lengths returns the code length of each symbol, indexed by symbol, with EOF last.
+func (d *Decoder) lengths() []int {
+	l := make([]int, d.eof+1)
+	for _, sym := range d.sym {
+		l[sym.s] = sym.length
+	}
+	return l
+}
+
+// ExpectedReadsPerSymbol returns the expected number of bits ReadSymbol
+// reads per symbol for a message with the given symbol counts, i.e. the
+// average code length.  If counts is nil, the distribution implied by the
+// code lengths themselves is used.
+func (d *Decoder) ExpectedReadsPerSymbol(counts []int) float64 {
+	lens := d.lengths()
+
+	var bits, total float64
+	if counts == nil {
+		for _, l := range lens {
+			if l != 0 {
+				p := 1 / float64(uint64(1)<<uint(l))
+				bits += p * float64(l)
+				total += p
+			}
+		}
+	} else {
+		for i, v := range counts {
+			if i < len(lens) {
+				bits += float64(v) * float64(lens[i])
+			}
+			total += float64(v)
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return bits / total
+}
+
+// decodeBitsPerSecond is roughly how many bits a single core gets through
+// in DecodeBytes, which reads a bit at a time whatever the codes.
+const decodeBitsPerSecond = 40e6
+
+// ThroughputEstimate returns a rough number of symbols per second one core
+// can decode, from the average code length implied by the code lengths and
+// the measured bit rate of the decoder.  It is meant for sizing parallel
+// work, not as a benchmark.
+func (d *Decoder) ThroughputEstimate() float64 {
+	bits := d.ExpectedReadsPerSymbol(nil)
+	if bits == 0 {
+		return 0
+	}
+	return decodeBitsPerSecond / bits
+}
+
+// Automaton returns the decoder's code trie as a state machine.  State 0 is
+// the root; trans[i][b] is the state reached from state i on bit b, or -1 if
+// no code continues that way.  emit[i] is -1 for internal states, and the
+// decoded symbol for leaves, with EOF emitted as -2.  Decoding restarts at
+// state 0 after each emitted symbol.
+func (d *Decoder) Automaton() (trans [][2]int, emit []int32) {
+	trans = [][2]int{{-1, -1}}
+	emit = []int32{-1}
+
+	for _, sym := range d.sym {
+		state := 0
+		for i := sym.length - 1; i >= 0; i-- {
+			b := (sym.code >> uint(i)) & 1
+			if trans[state][b] == -1 {
+				trans[state][b] = len(trans)
+				trans = append(trans, [2]int{-1, -1})
+				emit = append(emit, -1)
+			}
+			state = trans[state][b]
+		}
+		if sym.s == d.eof {
+			emit[state] = -2
+		} else {
+			emit[state] = int32(sym.s)
+		}
+	}
+
+	return trans, emit
+}
+
+// NewDecoderGzip reads a gzip-compressed codebook from r.
+func NewDecoderGzip(r io.Reader) (*Decoder, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	cb, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDecoder(cb)
+}
+
+func (d *Decoder) ReadSymbol(br *bitstream.BitReader) (uint32, error) {
+	s, _, err := d.readSymbol(br)
+	return s, err
+}
+
+// readSymbol is ReadSymbol, also returning the number of bits read
+func (d *Decoder) readSymbol(br *bitstream.BitReader) (uint32, int, error) {
+	var offset uint32
+	var code uint32
+
+	for i := 0; i+1 < len(d.numl); i++ {
+		b, err := br.ReadBit()
+		if err != nil {
+			return 0, i, err
+		}
+
+		code <<= 1
 		if b {
 			code |= 1
 		}
@@ -270,9 +1407,471 @@ func (d *Decoder) ReadSymbol(br *bitstream.BitReader) (uint32, error) {
 			if s == d.eof {
 				s = EOF
 			}
-			return s, nil
+			return s, i + 1, nil
+		}
+	}
+
+	return 0, len(d.numl) - 1, ErrUnknownSymbol
+}
+
+// DecodeToBuilder reads symbols from br until EOF, writing each one to b as a rune.
+func (d *Decoder) DecodeToBuilder(br *bitstream.BitReader, b *strings.Builder) error {
+	_, err := d.decode(br, func(s uint32, _ int) error {
+		if s != EOF {
+			b.WriteRune(rune(s))
+		}
+		return nil
+	})
+	return err
+}
+
+var ErrSymbolRange = errors.New("huff: symbol out of range")
+
+// DecodeMapped reads symbols from br until EOF, returning lut[s] for each symbol s.
+func (d *Decoder) DecodeMapped(br *bitstream.BitReader, lut []uint32) ([]uint32, error) {
+	var out []uint32
+	_, err := d.decode(br, func(s uint32, _ int) error {
+		if s == EOF {
+			return nil
+		}
+		if s >= uint32(len(lut)) {
+			return ErrSymbolRange
+		}
+		out = append(out, lut[s])
+		return nil
+	})
+	return out, err
+}
+
+var ErrNoSentinel = errors.New("huff: EOF before sentinel")
+
+// ReadUntil reads symbols from br up to, but not including, the next
+// occurrence of sentinel.  Reaching EOF first returns ErrNoSentinel.
+func (d *Decoder) ReadUntil(br *bitstream.BitReader, sentinel uint32) ([]uint32, error) {
+	var out []uint32
+	for {
+		s, err := d.ReadSymbol(br)
+		if err == io.EOF {
+			return out, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return out, err
+		}
+		if s == sentinel {
+			return out, nil
+		}
+		if s == EOF {
+			return out, ErrNoSentinel
+		}
+		out = append(out, s)
+	}
+}
+
+// decode reads symbols from br up to and including EOF, passing each one and
+// the number of bits its code took to fn, and returns the number of bits
+// read.  It stops at the first error from fn, and checks the number of
+// symbols against the count recorded by NewDecoderCounted, if any.
+func (d *Decoder) decode(br *bitstream.BitReader, fn func(s uint32, bits int) error) (int64, error) {
+	var n, nbits int64
+	for {
+		s, l, err := d.readSymbol(br)
+		if err == io.EOF {
+			return nbits, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nbits, err
+		}
+		nbits += int64(l)
+
+		if d.total >= 0 {
+			if s == EOF && n < d.total {
+				return nbits, ErrTruncated
+			}
+			if s != EOF && n == d.total {
+				return nbits, ErrSymbolCount
+			}
+		}
+
+		if err := fn(s, l); err != nil {
+			return nbits, err
+		}
+		if s == EOF {
+			return nbits, nil
+		}
+		n++
+	}
+}
+
+// decodeAll reads symbols from br until EOF
+func (d *Decoder) decodeAll(br *bitstream.BitReader) ([]uint32, error) {
+	return d.decodeCapped(br, -1)
+}
+
+// decodeCapped is decodeAll, returning ErrCapExceeded after maxSymbols
+// symbols if maxSymbols isn't negative
+func (d *Decoder) decodeCapped(br *bitstream.BitReader, maxSymbols int) ([]uint32, error) {
+	var out []uint32
+	_, err := d.decode(br, func(s uint32, _ int) error {
+		if s == EOF {
+			return nil
+		}
+		if len(out) == maxSymbols {
+			return ErrCapExceeded
+		}
+		out = append(out, s)
+		return nil
+	})
+	return out, err
+}
+
+// DecodeBytes decodes the symbols in data up to EOF.
+func (d *Decoder) DecodeBytes(data []byte) ([]uint32, error) {
+	return d.decodeAll(bitstream.NewReader(bytes.NewReader(data)))
+}
+
+var ErrCapExceeded = errors.New("huff: stream exceeds symbol cap")
+
+// DecodeCapped is like DecodeBytes, but stops with ErrCapExceeded as soon as
+// the stream holds more than maxSymbols symbols before EOF, so a short but
+// valid stream can't make it produce unbounded output.  A negative maxSymbols
+// allows no symbols.
+func (d *Decoder) DecodeCapped(data []byte, maxSymbols int) ([]uint32, error) {
+	if maxSymbols < 0 {
+		maxSymbols = 0
+	}
+	return d.decodeCapped(bitstream.NewReader(bytes.NewReader(data)), maxSymbols)
+}
+
+// DecodeOption changes how DecodeAll treats a stream.
+type DecodeOption int
+
+const (
+	// StrictTrailing makes DecodeAll return ErrTrailingData unless EOF is
+	// followed only by zero bits up to the end of its byte, and then by the
+	// end of the data.
+	StrictTrailing DecodeOption = 1 << iota
+)
+
+var ErrTrailingData = errors.New("huff: unexpected data after EOF")
+
+// DecodeAll is like DecodeBytes, with the given options applied.
+func (d *Decoder) DecodeAll(data []byte, opts ...DecodeOption) ([]uint32, error) {
+	var o DecodeOption
+	for _, opt := range opts {
+		o |= opt
+	}
+
+	br := bitstream.NewReader(bytes.NewReader(data))
+
+	var out []uint32
+	nbits, err := d.decode(br, func(s uint32, _ int) error {
+		if s != EOF {
+			out = append(out, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return out, err
+	}
+
+	if o&StrictTrailing != 0 {
+		for ; nbits%8 != 0; nbits++ {
+			if b, err := br.ReadBit(); err != nil || b != bitstream.Zero {
+				return out, ErrTrailingData
+			}
+		}
+		if _, err := br.ReadBit(); err != io.EOF {
+			return out, ErrTrailingData
+		}
+	}
+
+	return out, nil
+}
+
+// DecodeAliased is like DecodeBytes, but replaces each decoded symbol in
+// aliases by the symbol it maps to, as NewEncoderAliased does when writing.
+func (d *Decoder) DecodeAliased(data []byte, aliases map[uint32]uint32) ([]uint32, error) {
+	syms, err := d.DecodeBytes(data)
+	for i, s := range syms {
+		if t, ok := aliases[s]; ok {
+			syms[i] = t
+		}
+	}
+	return syms, err
+}
+
+type pooledReader struct {
+	r  *bytes.Reader
+	br *bitstream.BitReader
+}
+
+// DecodeBytesPooled is like DecodeBytes, but reuses bit readers from pool.
+// The pool should be used only with DecodeBytesPooled.
+func (d *Decoder) DecodeBytesPooled(data []byte, pool *sync.Pool) ([]uint32, error) {
+	p, ok := pool.Get().(*pooledReader)
+	if !ok {
+		r := bytes.NewReader(nil)
+		p = &pooledReader{r: r, br: bitstream.NewReader(r)}
+	}
+
+	p.r.Reset(data)
+	out, err := d.decodeAll(p.br)
+
+	// drain the reader so no buffered bits are left behind for the next use
+	for {
+		if _, err := p.br.ReadBit(); err != nil {
+			break
+		}
+	}
+	pool.Put(p)
+
+	return out, err
+}
+
+// Coverage decodes data and returns the fraction of the codebook's symbols,
+// not counting EOF, that appear in it.
+func (d *Decoder) Coverage(data []byte) (float64, error) {
+	syms, err := d.DecodeBytes(data)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for _, sym := range d.sym {
+		if sym.s != d.eof {
+			total++
+		}
+	}
+
+	if total == 0 {
+		return 0, nil
+	}
+
+	seen := make(map[uint32]bool)
+	for _, s := range syms {
+		seen[s] = true
+	}
+
+	return float64(len(seen)) / float64(total), nil
+}
+
+// Transcode decodes the symbols in src with from and re-encodes them with to,
+// without materializing the decoded symbols.  The output is terminated with
+// EOF and padded to a byte boundary.
+func Transcode(src []byte, from *Decoder, to *Encoder) ([]byte, error) {
+	br := bitstream.NewReader(bytes.NewReader(src))
+
+	var b bytes.Buffer
+	w := to.Writer(&b)
+
+	if _, err := from.decode(br, func(s uint32, _ int) error {
+		_, err := w.WriteSymbol(s)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.CloseN(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// EstimateDir returns the total size in bytes of the files in paths if each
+// were encoded as bytes with enc, plus one copy of the codebook they share.
+// It returns ErrUnknownSymbol if a file holds a byte enc has no code for.
+func EstimateDir(paths []string, enc *Encoder) (int64, error) {
+	total := int64(enc.CodebookSize())
+
+	counts := make([]int, 256)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+
+		for i := range counts {
+			counts[i] = 0
+		}
+		for _, b := range data {
+			counts[b]++
+		}
+		for i, v := range counts {
+			if v != 0 && enc.SymbolLen(uint32(i)) == 0 {
+				return 0, ErrUnknownSymbol
+			}
+		}
+
+		total += (enc.EncodedBits(counts) + 7) / 8
+	}
+
+	return total, nil
+}
+
+// DecodeLengthHistogram decodes data and returns the number of codes of each
+// length, indexed by length, that were read, including EOF.
+func (d *Decoder) DecodeLengthHistogram(data []byte) ([]int64, error) {
+	hist := make([]int64, len(d.numl))
+	_, err := d.decode(bitstream.NewReader(bytes.NewReader(data)), func(_ uint32, l int) error {
+		hist[l]++
+		return nil
+	})
+	return hist, err
+}
+
+// PeekDepth returns the length of the shortest code, and the smallest number
+// of bits that resolves at least 90% of the symbols of a message with the
+// given counts.  With no counts, both are the shortest code length.
+func (d *Decoder) PeekDepth(counts []int) (minBits, p90Bits int) {
+	if len(d.sym) == 0 {
+		return 0, 0
+	}
+
+	// d.sym is sorted by length
+	minBits = d.sym[0].length
+
+	lens := d.lengths()
+	hist := make([]int64, len(d.numl))
+	var total int64
+	for i, v := range counts {
+		if i < len(lens) && lens[i] != 0 {
+			hist[lens[i]] += int64(v)
+			total += int64(v)
+		}
+	}
+
+	if total == 0 {
+		return minBits, minBits
+	}
+
+	var n int64
+	for l, c := range hist {
+		n += c
+		if n*10 >= total*9 {
+			return minBits, l
+		}
+	}
+
+	return minBits, len(d.numl) - 1
+}
+
+// DecodeFixed reads symbols from br into dst until EOF, without allocating,
+// and returns the number of symbols read.  It returns io.ErrShortBuffer if
+// dst fills up before EOF.
+func (d *Decoder) DecodeFixed(br *bitstream.BitReader, dst []uint32) (int, error) {
+	var n int
+	_, err := d.decode(br, func(s uint32, _ int) error {
+		if s == EOF {
+			return nil
+		}
+		if n == len(dst) {
+			return io.ErrShortBuffer
+		}
+		dst[n] = s
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// TableHitRate decodes data and returns the fraction of its symbols, including
+// EOF, whose codes are at most maxBits long, so a lookup table indexed by the
+// next maxBits bits resolves them without falling back to reading bit by bit.
+func (d *Decoder) TableHitRate(data []byte, maxBits int) (float64, error) {
+	var hits, total int
+	_, err := d.decode(bitstream.NewReader(bytes.NewReader(data)), func(_ uint32, l int) error {
+		total++
+		if l <= maxBits {
+			hits++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return float64(hits) / float64(total), nil
+}
+
+// DecodeLatencyStats decodes data and returns the largest and the average,
+// rounded to the nearest bit, number of bits ReadSymbol read per symbol,
+// including EOF.
+func (d *Decoder) DecodeLatencyStats(data []byte) (maxReads, avgReads int, err error) {
+	var n int
+	reads, err := d.decode(bitstream.NewReader(bytes.NewReader(data)), func(_ uint32, l int) error {
+		n++
+		if l > maxReads {
+			maxReads = l
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return maxReads, (int(reads) + n/2) / n, nil
+}
+
+// DecodeExpect is like DecodeBytes, but returns ErrTruncated or
+// ErrSymbolCount if the number of symbols before EOF isn't expected.
+func (d *Decoder) DecodeExpect(data []byte, expected int) ([]uint32, error) {
+	syms, err := d.DecodeBytes(data)
+	if err != nil {
+		return syms, err
+	}
+
+	if len(syms) < expected {
+		return syms, ErrTruncated
+	}
+	if len(syms) > expected {
+		return syms, ErrSymbolCount
+	}
+
+	return syms, nil
+}
+
+// DecodeChecksum is like DecodeBytes, but also returns the IEEE CRC-32 of the
+// decoded bytes, computed as they are decoded, so it matches
+// crc32.ChecksumIEEE of the original data.  EOF is not included.  It returns
+// ErrSymbolRange for a symbol that isn't a byte.
+func (d *Decoder) DecodeChecksum(data []byte) (syms []uint32, crc uint32, err error) {
+	var buf [1]byte
+	_, err = d.decode(bitstream.NewReader(bytes.NewReader(data)), func(s uint32, _ int) error {
+		if s == EOF {
+			return nil
+		}
+		if s > 0xff {
+			return ErrSymbolRange
+		}
+		buf[0] = byte(s)
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:])
+		syms = append(syms, s)
+		return nil
+	})
+	return syms, crc, err
+}
+
+// Integer is the set of types DecodeTyped can decode into.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// DecodeTyped is like d.DecodeBytes, but converts the symbols to T.  It
+// returns ErrSymbolRange if a symbol doesn't fit in T.
+func DecodeTyped[T Integer](d *Decoder, data []byte) ([]T, error) {
+	syms, err := d.DecodeBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]T, len(syms))
+	for i, s := range syms {
+		v := T(s)
+		if v < 0 || uint64(v) != uint64(s) {
+			return nil, ErrSymbolRange
 		}
+		out[i] = v
 	}
 
-	return 0, ErrUnknownSymbol
+	return out, nil
 }
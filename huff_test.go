@@ -2,8 +2,19 @@ package huff
 
 import (
 	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"encoding/binary"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/dgryski/go-bitstream"
@@ -71,3 +82,1902 @@ func TestRoundtrip(t *testing.T) {
 		t.Errorf("bytes compare found mismatch")
 	}
 }
+
+func maxSymbolLen(e *Encoder, n int) int {
+	var max int
+	for i := 0; i < n; i++ {
+		if l := e.SymbolLen(uint32(i)); l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+func totalBits(e *Encoder, counts []int) int {
+	var bits int
+	for i, v := range counts {
+		bits += v * e.SymbolLen(uint32(i))
+	}
+	return bits
+}
+
+func TestEncoderFloor(t *testing.T) {
+
+	counts := make([]int, 24)
+	for i := range counts {
+		counts[i] = 1 << uint(i)
+	}
+
+	e := NewEncoder(counts)
+	f := NewEncoderFloor(counts, 1<<14)
+
+	emax, fmax := maxSymbolLen(e, len(counts)), maxSymbolLen(f, len(counts))
+	if fmax >= emax {
+		t.Errorf("max code length not reduced: %d -> %d", emax, fmax)
+	}
+
+	ebits, fbits := totalBits(e, counts), totalBits(f, counts)
+	if fbits < ebits {
+		t.Errorf("floored encoder beat optimal: %d < %d", fbits, ebits)
+	}
+	if float64(fbits) > float64(ebits)*1.01 {
+		t.Errorf("floored encoder too costly: %d -> %d bits", ebits, fbits)
+	}
+}
+
+func TestCloseN(t *testing.T) {
+
+	e := NewEncoder([]int{10, 5, 3, 1, 1})
+
+	var b bytes.Buffer
+	w := e.Writer(&b)
+
+	var total int
+	for _, s := range []uint32{0, 1, 2, 3, 4, 0, 0, 1, EOF} {
+		n, _ := w.WriteSymbol(s)
+		total += n
+	}
+
+	pad, err := w.CloseN()
+	if err != nil {
+		t.Fatalf("CloseN: %v", err)
+	}
+
+	if want := (8 - total%8) % 8; pad != want {
+		t.Errorf("pad = %d, want %d", pad, want)
+	}
+
+	if b.Len()*8 != total+pad {
+		t.Errorf("wrote %d bytes for %d bits + %d padding", b.Len(), total, pad)
+	}
+
+	if pad, _ := w.CloseN(); pad != 0 {
+		t.Errorf("second CloseN padded %d bits", pad)
+	}
+}
+
+func TestDecodeToBuilder(t *testing.T) {
+
+	text := "Hello, world! Grüße aus Köln. Привет, мир! こんにちは世界 🌍 你好，世界"
+
+	var maxr rune
+	for _, r := range text {
+		if r > maxr {
+			maxr = r
+		}
+	}
+
+	counts := make([]int, maxr+1)
+	for _, r := range text {
+		counts[r]++
+	}
+
+	e := NewEncoder(counts)
+
+	var b bytes.Buffer
+	w := e.Writer(&b)
+	for _, r := range text {
+		w.WriteSymbol(uint32(r))
+	}
+	w.WriteSymbol(EOF)
+	w.Close()
+
+	var sb strings.Builder
+	if err := e.Decoder().DecodeToBuilder(bitstream.NewReader(&b), &sb); err != nil {
+		t.Fatalf("DecodeToBuilder: %v", err)
+	}
+
+	if sb.String() != text {
+		t.Errorf("got %q, want %q", sb.String(), text)
+	}
+}
+
+func TestCodebookHash(t *testing.T) {
+
+	a := NewEncoder([]int{10, 5, 3, 1})
+	b := NewEncoder([]int{20, 10, 6, 2})
+	c := NewEncoder([]int{1, 3, 5, 10})
+	d := NewEncoder([]int{10, 5, 3, 1, 1})
+
+	if a.CodebookHash() != b.CodebookHash() {
+		t.Errorf("equivalent codebooks hashed differently")
+	}
+
+	if a.CodebookHash() == c.CodebookHash() {
+		t.Errorf("different codebooks hashed equal")
+	}
+
+	if a.CodebookHash() == d.CodebookHash() {
+		t.Errorf("codebooks with different alphabets hashed equal")
+	}
+}
+
+func encodeSymbols(e *Encoder, syms []uint32) []byte {
+	var b bytes.Buffer
+	w := e.Writer(&b)
+	for _, s := range syms {
+		w.WriteSymbol(s)
+	}
+	w.WriteSymbol(EOF)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestDecodeMapped(t *testing.T) {
+
+	e := NewEncoder([]int{7, 3, 2, 1})
+	syms := []uint32{0, 1, 0, 2, 3, 0, 1, 0, 0}
+	data := encodeSymbols(e, syms)
+
+	lut := []uint32{100, 200, 300, 400}
+
+	got, err := e.Decoder().DecodeMapped(bitstream.NewReader(bytes.NewReader(data)), lut)
+	if err != nil {
+		t.Fatalf("DecodeMapped: %v", err)
+	}
+
+	var want []uint32
+	br := bitstream.NewReader(bytes.NewReader(data))
+	for {
+		s, err := e.Decoder().ReadSymbol(br)
+		if err != nil {
+			t.Fatalf("ReadSymbol: %v", err)
+		}
+		if s == EOF {
+			break
+		}
+		want = append(want, lut[s])
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d symbols, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("symbol %d: got %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	_, err = e.Decoder().DecodeMapped(bitstream.NewReader(bytes.NewReader(data)), lut[:3])
+	if err != ErrSymbolRange {
+		t.Errorf("short lut: err = %v, want %v", err, ErrSymbolRange)
+	}
+}
+
+func TestEncoderFromPairs(t *testing.T) {
+
+	pairs := []SymCount{{1, 40}, {4, 12}, {5, 7}, {9, 30}, {12, 1}, {13, 3}}
+
+	counts := make([]int, 14)
+	for _, p := range pairs {
+		counts[p.Sym] = p.Count
+	}
+
+	e, err := NewEncoderFromPairs(pairs)
+	if err != nil {
+		t.Fatalf("NewEncoderFromPairs: %v", err)
+	}
+
+	if !bytes.Equal(e.CodebookBytes(), NewEncoder(counts).CodebookBytes()) {
+		t.Errorf("pairs codebook differs from dense codebook")
+	}
+
+	shuffled := []SymCount{pairs[3], pairs[0], pairs[5], pairs[2], pairs[1], pairs[4]}
+	e, err = NewEncoderFromPairs(shuffled)
+	if err != nil {
+		t.Fatalf("NewEncoderFromPairs(shuffled): %v", err)
+	}
+
+	if !bytes.Equal(e.CodebookBytes(), NewEncoder(counts).CodebookBytes()) {
+		t.Errorf("unsorted pairs codebook differs from dense codebook")
+	}
+
+	if _, err := NewEncoderFromPairs(append(pairs, SymCount{4, 2})); err != ErrDuplicateSymbol {
+		t.Errorf("duplicate: err = %v, want %v", err, ErrDuplicateSymbol)
+	}
+
+	for _, sym := range []uint32{0xfffffffe, 0xffffffff} {
+		if _, err := NewEncoderFromPairs([]SymCount{{1, 3}, {sym, 1}}); err != ErrSymbolRange {
+			t.Errorf("symbol %#x: err = %v, want %v", sym, err, ErrSymbolRange)
+		}
+	}
+}
+
+func TestEncoderFromPairsSparse(t *testing.T) {
+
+	// a dense codebook would need an entry for each of the 1<<30 symbols
+	e, err := NewEncoderFromPairs([]SymCount{{3, 10}, {1 << 20, 5}, {1 << 30, 2}})
+	if err != nil {
+		t.Fatalf("NewEncoderFromPairs: %v", err)
+	}
+	if len(e.m) != 4 {
+		t.Errorf("codebook has %d entries, want 4", len(e.m))
+	}
+
+	for _, tt := range []struct {
+		s   uint32
+		len int
+	}{{3, 1}, {1 << 20, 2}, {1 << 30, 3}, {EOF, 3}, {4, 0}, {1<<30 - 1, 0}} {
+		if l := e.SymbolLen(tt.s); l != tt.len {
+			t.Errorf("SymbolLen(%d) = %d, want %d", tt.s, l, tt.len)
+		}
+	}
+
+	syms := []uint32{1 << 30, 3, 1 << 20, 3}
+	got, err := e.Decoder().DecodeBytes(encodeSymbols(e, syms))
+	if err != nil || len(got) != len(syms) {
+		t.Fatalf("DecodeBytes = %v (%v), want %v", got, err, syms)
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Fatalf("DecodeBytes = %v, want %v", got, syms)
+		}
+	}
+
+	if _, err := e.Writer(io.Discard).WriteSymbol(4); err != ErrUnknownSymbol {
+		t.Errorf("unused symbol: err = %v, want %v", err, ErrUnknownSymbol)
+	}
+}
+
+func TestReadUntil(t *testing.T) {
+
+	const sep = 3
+
+	e := NewEncoder([]int{10, 8, 6, 2})
+	data := encodeSymbols(e, []uint32{0, 1, 2, 0, sep, 2, 2, 1, sep, 0})
+
+	d := e.Decoder()
+	br := bitstream.NewReader(bytes.NewReader(data))
+
+	for i, want := range [][]uint32{{0, 1, 2, 0}, {2, 2, 1}} {
+		got, err := d.ReadUntil(br, sep)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("record %d: got %v, want %v", i, got, want)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("record %d: got %v, want %v", i, got, want)
+				break
+			}
+		}
+	}
+
+	got, err := d.ReadUntil(br, sep)
+	if err != ErrNoSentinel {
+		t.Errorf("last record: err = %v, want %v", err, ErrNoSentinel)
+	}
+	if len(got) != 1 || got[0] != 0 {
+		t.Errorf("last record: got %v, want [0]", got)
+	}
+}
+
+func TestTransmissionOverhead(t *testing.T) {
+
+	counts := make([]int, 256)
+	for i := range counts {
+		counts[i] = 1 + i%7
+	}
+
+	e := NewEncoder(counts)
+
+	tiny := make([]int, 256)
+	tiny['a'], tiny['b'] = 3, 2
+
+	large := make([]int, 256)
+	for i := range large {
+		large[i] = counts[i] * 1000
+	}
+
+	if o := e.TransmissionOverhead(tiny); o < 1 {
+		t.Errorf("tiny payload overhead = %f, want > 1", o)
+	}
+
+	if o := e.TransmissionOverhead(large); o > 0.01 {
+		t.Errorf("large payload overhead = %f, want < 0.01", o)
+	}
+
+	data := encodeSymbols(e, []uint32{'a', 'b', 'a'})
+	if bits := e.EncodedBits([]int{'a': 2, 'b': 1}); (bits+7)/8 != int64(len(data)) {
+		t.Errorf("EncodedBits = %d, but encoding took %d bytes", bits, len(data))
+	}
+}
+
+func TestDecoderInvalidCodebook(t *testing.T) {
+
+	for _, lengths := range [][]int{
+		{},
+		{0, 0, 0},
+		{1, 1, 1},
+		{1, 2, 2, 2},
+		{2, 2, 2, 2, 3},
+		{33, 1},
+	} {
+		c := make(codebook, len(lengths))
+		for i, l := range lengths {
+			c[i] = symbol{s: uint32(i), length: l}
+		}
+		b, _ := c.MarshalBinary()
+		if _, err := NewDecoder(b); err != ErrInvalidCodebook {
+			t.Errorf("lengths %v: err = %v, want %v", lengths, err, ErrInvalidCodebook)
+		}
+	}
+
+	// incomplete codes are accepted, but unassigned codes don't decode
+	c := codebook{{s: 0, length: 1}, {s: 1, length: 2}}
+	b, _ := c.MarshalBinary()
+	d, err := NewDecoder(b)
+	if err != nil {
+		t.Fatalf("incomplete code: %v", err)
+	}
+	if _, err := d.ReadSymbol(bitstream.NewReader(bytes.NewReader([]byte{0xff}))); err != ErrUnknownSymbol {
+		t.Errorf("unassigned code: err = %v, want %v", err, ErrUnknownSymbol)
+	}
+}
+
+func TestCommonPrefixLen(t *testing.T) {
+
+	// lengths 1, 2, 3, 4, 4 (EOF): codes 0, 10, 110, 1110, 1111
+	e := NewEncoder([]int{16, 8, 4, 2})
+
+	for _, tt := range []struct {
+		a, b uint32
+		want int
+	}{
+		{0, 1, 0},
+		{1, 2, 1},
+		{2, 3, 2},
+		{3, EOF, 3},
+		{2, EOF, 2},
+		{3, 3, 4},
+		{0, 0, 1},
+		{0, 99, 0},
+	} {
+		if got := e.CommonPrefixLen(tt.a, tt.b); got != tt.want {
+			t.Errorf("CommonPrefixLen(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuboptimalities(t *testing.T) {
+
+	static := NewEncoder([]int{16, 8, 4, 2, 1})
+
+	if subs := static.Suboptimalities([]int{16, 8, 4, 2, 1}); len(subs) != 0 {
+		t.Errorf("matching distribution reported %v", subs)
+	}
+
+	subs := static.Suboptimalities([]int{1, 2, 4, 8, 16})
+	if len(subs) == 0 {
+		t.Fatalf("shifted distribution reported nothing")
+	}
+
+	var found bool
+	for _, s := range subs {
+		if s.AssignedLen != static.SymbolLen(s.Sym) {
+			t.Errorf("symbol %d: AssignedLen = %d, want %d", s.Sym, s.AssignedLen, static.SymbolLen(s.Sym))
+		}
+		if s.Sym == 4 {
+			found = true
+			if s.IdealLen >= s.AssignedLen {
+				t.Errorf("symbol 4: ideal length %d not shorter than assigned %d", s.IdealLen, s.AssignedLen)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("most frequent symbol not reported: %v", subs)
+	}
+}
+
+func TestDecoderGzip(t *testing.T) {
+
+	e := NewEncoder([]int{9, 4, 4, 2, 1})
+	syms := []uint32{0, 1, 2, 3, 4, 0, 0, 2}
+	data := encodeSymbols(e, syms)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(e.CodebookBytes())
+	zw.Close()
+
+	d, err := NewDecoderGzip(&gz)
+	if err != nil {
+		t.Fatalf("NewDecoderGzip: %v", err)
+	}
+
+	got, err := d.DecodeMapped(bitstream.NewReader(bytes.NewReader(data)), []uint32{0, 1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != len(syms) {
+		t.Fatalf("got %v, want %v", got, syms)
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Errorf("got %v, want %v", got, syms)
+			break
+		}
+	}
+
+	if _, err := NewDecoderGzip(bytes.NewReader(e.CodebookBytes())); err == nil {
+		t.Errorf("plain codebook accepted as gzip")
+	}
+}
+
+func TestExpectedReadsPerSymbol(t *testing.T) {
+
+	counts := []int{50, 20, 20, 5, 3, 1, 1}
+	e := NewEncoder(counts)
+
+	var n int
+	for _, v := range counts {
+		n += v
+	}
+	avg := float64(totalBits(e, counts)) / float64(n)
+
+	if got := e.Decoder().ExpectedReadsPerSymbol(counts); math.Abs(got-avg) > 1e-9 {
+		t.Errorf("ExpectedReadsPerSymbol = %f, want %f", got, avg)
+	}
+
+	// lengths 1, 2, 3, 3 are a dyadic distribution of their own
+	d := NewEncoder([]int{4, 2, 1}).Decoder()
+	if got, want := d.ExpectedReadsPerSymbol(nil), 1.75; math.Abs(got-want) > 1e-9 {
+		t.Errorf("ExpectedReadsPerSymbol(nil) = %f, want %f", got, want)
+	}
+}
+
+func TestAutomaton(t *testing.T) {
+
+	counts := []int{30, 1, 12, 7, 7, 2, 0, 19, 4}
+	e := NewEncoder(counts)
+
+	var syms []uint32
+	for i, v := range counts {
+		for j := 0; j < v; j++ {
+			syms = append(syms, uint32(i))
+		}
+	}
+	data := encodeSymbols(e, syms)
+
+	d := e.Decoder()
+	trans, emit := d.Automaton()
+
+	if len(trans) != len(emit) {
+		t.Fatalf("len(trans) = %d, len(emit) = %d", len(trans), len(emit))
+	}
+
+	var want []int32
+	br := bitstream.NewReader(bytes.NewReader(data))
+	for {
+		s, err := d.ReadSymbol(br)
+		if err != nil {
+			t.Fatalf("ReadSymbol: %v", err)
+		}
+		if s == EOF {
+			want = append(want, -2)
+			break
+		}
+		want = append(want, int32(s))
+	}
+
+	var got []int32
+	br = bitstream.NewReader(bytes.NewReader(data))
+	for state := 0; len(got) < len(want); {
+		b, err := br.ReadBit()
+		if err != nil {
+			t.Fatalf("ReadBit: %v", err)
+		}
+		next := trans[state][0]
+		if b {
+			next = trans[state][1]
+		}
+		if next < 0 {
+			t.Fatalf("dead transition from state %d", state)
+		}
+		if emit[next] != -1 {
+			got = append(got, emit[next])
+			next = 0
+		}
+		state = next
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("symbol %d: automaton %d, ReadSymbol %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEOFOverheadBits(t *testing.T) {
+
+	// without EOF, four equal symbols take exactly 2 bits each
+	counts := []int{10, 10, 10, 10}
+	e := NewEncoder(counts)
+
+	over := e.EOFOverheadBits(counts)
+	if over <= 0 {
+		t.Fatalf("EOFOverheadBits = %d, want > 0", over)
+	}
+
+	if want := e.EncodedBits(counts) - 80; over != want {
+		t.Errorf("EOFOverheadBits = %d, want %d", over, want)
+	}
+
+	// a lone symbol needs one bit either way, plus one for EOF
+	if over := NewEncoder([]int{5}).EOFOverheadBits([]int{5}); over != 1 {
+		t.Errorf("single symbol: EOFOverheadBits = %d, want 1", over)
+	}
+}
+
+func TestEncoderClamped(t *testing.T) {
+
+	counts := make([]int, 20)
+	for i := range counts {
+		counts[i] = 1 << uint(i)
+	}
+
+	e := NewEncoder(counts)
+	c := NewEncoderClamped(counts, 50)
+
+	emax, cmax := maxSymbolLen(e, len(counts)), maxSymbolLen(c, len(counts))
+	if cmax >= emax {
+		t.Errorf("max code length not reduced: %d -> %d", emax, cmax)
+	}
+
+	if !bytes.Equal(NewEncoderClamped(counts, 100).CodebookBytes(), e.CodebookBytes()) {
+		t.Errorf("100th percentile changed the codebook")
+	}
+}
+
+func TestCodebookBytesRoundTrip(t *testing.T) {
+
+	counts := []int{60, 25, 10, 4, 1, 0, 1}
+	syms := []uint32{0, 0, 1, 0, 2, 0, 1, 3, 0, 0, 1, 4, 0, 2, 6, 0}
+
+	limited, _ := NewEncoderLimited(counts, 3)
+	pairs, _ := NewEncoderFromPairs([]SymCount{{0, 60}, {1, 25}, {2, 10}, {3, 4}, {4, 1}, {6, 1}})
+
+	for name, e := range map[string]*Encoder{
+		"plain":   NewEncoder(counts),
+		"floor":   NewEncoderFloor(counts, 8),
+		"clamped": NewEncoderClamped(counts, 50),
+		"limited": limited,
+		"seeded":  NewEncoderSeeded(counts, 3),
+		"pairs":   pairs,
+	} {
+		d, err := NewDecoder(e.CodebookBytes())
+		if err != nil {
+			t.Fatalf("%s: NewDecoder: %v", name, err)
+		}
+		got, err := d.DecodeBytes(encodeSymbols(e, syms))
+		if err != nil || !slices.Equal(got, syms) {
+			t.Errorf("%s: DecodeBytes = %v (%v), want %v", name, got, err, syms)
+		}
+	}
+}
+
+func TestDecodeBytes(t *testing.T) {
+
+	e := NewEncoder([]int{12, 6, 3, 3, 1})
+	d := e.Decoder()
+
+	var pool sync.Pool
+
+	for _, syms := range [][]uint32{
+		{0, 1, 2, 3, 4},
+		{4, 4, 4},
+		{},
+		{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+	} {
+		data := encodeSymbols(e, syms)
+
+		got, err := d.DecodeBytes(data)
+		if err != nil {
+			t.Fatalf("DecodeBytes(%v): %v", syms, err)
+		}
+		pooled, err := d.DecodeBytesPooled(data, &pool)
+		if err != nil {
+			t.Fatalf("DecodeBytesPooled(%v): %v", syms, err)
+		}
+
+		if len(got) != len(syms) || len(pooled) != len(syms) {
+			t.Fatalf("got %v and %v, want %v", got, pooled, syms)
+		}
+		for i := range syms {
+			if got[i] != syms[i] || pooled[i] != syms[i] {
+				t.Fatalf("got %v and %v, want %v", got, pooled, syms)
+			}
+		}
+	}
+
+	data := encodeSymbols(e, []uint32{0, 1, 2})
+	if _, err := d.DecodeBytes(data[:len(data)-1]); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func benchmarkDecodeData() (*Decoder, [][]byte) {
+	counts := make([]int, 256)
+	for i := range counts {
+		counts[i] = 1 + i%17
+	}
+	e := NewEncoder(counts)
+
+	var msgs [][]byte
+	for i := 0; i < 64; i++ {
+		msgs = append(msgs, encodeSymbols(e, []uint32{uint32(i), uint32(i * 3 % 256), uint32(i * 7 % 256)}))
+	}
+	return e.Decoder(), msgs
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	d, msgs := benchmarkDecodeData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.DecodeBytes(msgs[i%len(msgs)])
+	}
+}
+
+func BenchmarkDecodeBytesPooled(b *testing.B) {
+	d, msgs := benchmarkDecodeData()
+	var pool sync.Pool
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.DecodeBytesPooled(msgs[i%len(msgs)], &pool)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+
+	counts := make([]int, 10)
+	for i := range counts {
+		counts[i] = i + 1
+	}
+	e := NewEncoder(counts)
+	d := e.Decoder()
+
+	for _, tt := range []struct {
+		syms []uint32
+		want float64
+	}{
+		{[]uint32{1, 1, 2, 3, 2, 1}, 0.3},
+		{[]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 1},
+		{nil, 0},
+	} {
+		got, err := d.Coverage(encodeSymbols(e, tt.syms))
+		if err != nil {
+			t.Fatalf("Coverage(%v): %v", tt.syms, err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Coverage(%v) = %f, want %f", tt.syms, got, tt.want)
+		}
+	}
+}
+
+func TestTranscode(t *testing.T) {
+
+	from := NewEncoder([]int{50, 20, 10, 5, 1, 1})
+	to := NewEncoder([]int{1, 1, 5, 10, 20, 50})
+
+	syms := []uint32{0, 0, 1, 2, 5, 4, 3, 0, 1, 1, 0, 5, 5}
+	src := encodeSymbols(from, syms)
+
+	dst, err := Transcode(src, from.Decoder(), to)
+	if err != nil {
+		t.Fatalf("Transcode: %v", err)
+	}
+
+	if bytes.Equal(src, dst) {
+		t.Errorf("transcoding did not change the encoding")
+	}
+
+	if !bytes.Equal(dst, encodeSymbols(to, syms)) {
+		t.Errorf("transcoded output differs from direct encoding")
+	}
+
+	got, err := to.Decoder().DecodeBytes(dst)
+	if err != nil {
+		t.Fatalf("DecodeBytes: %v", err)
+	}
+	if len(got) != len(syms) {
+		t.Fatalf("got %v, want %v", got, syms)
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Fatalf("got %v, want %v", got, syms)
+		}
+	}
+
+	// the target codebook has no code for symbol 2 or beyond 3
+	for _, counts := range [][]int{{1, 1, 1}, {1, 1, 0, 1, 1, 1}} {
+		if _, err := Transcode(src, from.Decoder(), NewEncoder(counts)); err != ErrUnknownSymbol {
+			t.Errorf("target %v: err = %v, want %v", counts, err, ErrUnknownSymbol)
+		}
+	}
+}
+
+func TestNoEOF(t *testing.T) {
+
+	counts := []int{9, 5, 3, 1}
+	e := NewEncoderNoEOF(counts)
+
+	if l := e.SymbolLen(EOF); l != 0 {
+		t.Errorf("SymbolLen(EOF) = %d, want 0", l)
+	}
+
+	syms := []uint32{0, 3, 1, 0, 2, 0, 3, 3}
+
+	var b bytes.Buffer
+	w := e.Writer(&b)
+	for _, s := range syms {
+		if _, err := w.WriteSymbol(s); err != nil {
+			t.Fatalf("WriteSymbol(%d): %v", s, err)
+		}
+	}
+	if _, err := w.WriteSymbol(EOF); err != ErrUnknownSymbol {
+		t.Errorf("WriteSymbol(EOF): err = %v, want %v", err, ErrUnknownSymbol)
+	}
+	w.Close()
+
+	data := b.Bytes()
+	cb := e.CodebookBytes()
+
+	d, err := NewDecoderNoEOF(cb)
+	if err != nil {
+		t.Fatalf("NewDecoderNoEOF: %v", err)
+	}
+
+	br := bitstream.NewReader(bytes.NewReader(data))
+	for i, want := range syms {
+		got, err := d.ReadSymbol(br)
+		if err != nil {
+			t.Fatalf("symbol %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("symbol %d: got %d, want %d", i, got, want)
+		}
+	}
+
+	// NewDecoder takes the last symbol to be EOF
+	d, err = NewDecoder(cb)
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+	if s, _ := d.ReadSymbol(bitstream.NewReader(bytes.NewReader(encodeNoEOF(e, 3)))); s != EOF {
+		t.Errorf("NewDecoder decoded the last symbol as %d, want EOF", s)
+	}
+
+	single := NewEncoderNoEOF([]int{0, 7})
+	if l := single.SymbolLen(1); l != 1 {
+		t.Errorf("lone symbol length = %d, want 1", l)
+	}
+}
+
+func encodeNoEOF(e *Encoder, syms ...uint32) []byte {
+	var b bytes.Buffer
+	w := e.Writer(&b)
+	for _, s := range syms {
+		w.WriteSymbol(s)
+	}
+	w.Close()
+	return b.Bytes()
+}
+
+func TestNewEncoders(t *testing.T) {
+
+	tables := [][]int{
+		{10, 5, 1},
+		{1, 1, 1, 1, 1, 1, 1, 1},
+		{0, 0, 3, 0, 9},
+	}
+
+	encs, err := NewEncoders(tables...)
+	if err != nil {
+		t.Fatalf("NewEncoders: %v", err)
+	}
+	if len(encs) != len(tables) {
+		t.Fatalf("got %d encoders, want %d", len(encs), len(tables))
+	}
+
+	for i, e := range encs {
+		if !bytes.Equal(e.CodebookBytes(), NewEncoder(tables[i]).CodebookBytes()) {
+			t.Errorf("encoder %d differs from NewEncoder", i)
+		}
+
+		var syms []uint32
+		for s, v := range tables[i] {
+			if v != 0 {
+				syms = append(syms, uint32(s))
+			}
+		}
+		got, err := e.Decoder().DecodeBytes(encodeSymbols(e, syms))
+		if err != nil || len(got) != len(syms) {
+			t.Errorf("encoder %d: got %v (%v), want %v", i, got, err, syms)
+		}
+	}
+
+	if _, err := NewEncoders(tables[0], []int{0, 0}, tables[2]); err != ErrNoSymbols {
+		t.Errorf("empty table: err = %v, want %v", err, ErrNoSymbols)
+	}
+}
+
+func TestEstimateDir(t *testing.T) {
+
+	dir := t.TempDir()
+
+	files := []string{
+		strings.Repeat("the quick brown fox jumps over the lazy dog\n", 200),
+		strings.Repeat("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaab", 50),
+		"hello, world\n",
+	}
+
+	counts := make([]int, 256)
+	var paths []string
+	for i, f := range files {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+		for _, b := range []byte(f) {
+			counts[b]++
+		}
+	}
+
+	e := NewEncoder(counts)
+
+	est, err := EstimateDir(paths, e)
+	if err != nil {
+		t.Fatalf("EstimateDir: %v", err)
+	}
+
+	actual := int64(e.CodebookSize())
+	for _, f := range files {
+		syms := make([]uint32, len(f))
+		for i, b := range []byte(f) {
+			syms[i] = uint32(b)
+		}
+		actual += int64(len(encodeSymbols(e, syms)))
+	}
+
+	if diff := est - actual; diff < -int64(len(files)) || diff > int64(len(files)) {
+		t.Errorf("estimate %d, actual %d", est, actual)
+	}
+
+	if _, err := EstimateDir([]string{filepath.Join(dir, "missing")}, e); err == nil {
+		t.Errorf("missing file: no error")
+	}
+
+	if _, err := EstimateDir(paths, NewEncoder([]int{'a': 1, 'b': 1})); err != ErrUnknownSymbol {
+		t.Errorf("unencodable bytes: err = %v, want %v", err, ErrUnknownSymbol)
+	}
+}
+
+func TestReproducibleCodebook(t *testing.T) {
+
+	// lots of ties in the weights
+	counts := []int{5, 3, 5, 3, 5, 8, 2, 2, 8, 5, 3, 1, 1, 2, 8, 5}
+
+	want := NewEncoder(counts).CodebookBytes()
+
+	perms := [][]int{{}, {}, {}}
+	for i := range counts {
+		perms[0] = append(perms[0], len(counts)-1-i)
+		perms[1] = append(perms[1], (i*7)%len(counts))
+		perms[2] = append(perms[2], (i*5+3)%len(counts))
+	}
+
+	for _, perm := range perms {
+		var n nodes
+		for _, i := range perm {
+			heap.Push(&n, node{weight: counts[i], leaf: true, sym: uint32(i)})
+		}
+		if got := buildEncoder(n, uint32(len(counts))).CodebookBytes(); !bytes.Equal(got, want) {
+			t.Errorf("insertion order %v changed the codebook", perm)
+		}
+
+		var pairs []SymCount
+		for _, i := range perm {
+			pairs = append(pairs, SymCount{Sym: uint32(i), Count: counts[i]})
+		}
+		e, err := NewEncoderFromPairs(pairs)
+		if err != nil {
+			t.Fatalf("NewEncoderFromPairs: %v", err)
+		}
+		if got := e.CodebookBytes(); !bytes.Equal(got, want) {
+			t.Errorf("pairs order %v changed the codebook", perm)
+		}
+	}
+}
+
+func TestBitOffsetAfter(t *testing.T) {
+
+	e := NewEncoder([]int{20, 9, 4, 4, 1})
+	syms := []uint32{0, 4, 2, 1, 0, 3, 3, 0, EOF}
+
+	w := e.Writer(io.Discard)
+
+	var off int64
+	for i, s := range syms {
+		got, err := e.BitOffsetAfter(syms, i)
+		if err != nil {
+			t.Fatalf("BitOffsetAfter(%d): %v", i, err)
+		}
+		if got != off || got != w.bits {
+			t.Errorf("BitOffsetAfter(%d) = %d, writer at %d", i, got, off)
+		}
+		n, _ := w.WriteSymbol(s)
+		off += int64(n)
+	}
+
+	if got, _ := e.BitOffsetAfter(syms, len(syms)); got != off {
+		t.Errorf("BitOffsetAfter(%d) = %d, want %d", len(syms), got, off)
+	}
+
+	if _, err := e.BitOffsetAfter(syms, len(syms)+1); err != ErrShortSymbols {
+		t.Errorf("n too large: err = %v, want %v", err, ErrShortSymbols)
+	}
+
+	if _, err := e.BitOffsetAfter([]uint32{0, 7}, 2); err != ErrUnknownSymbol {
+		t.Errorf("unknown symbol: err = %v, want %v", err, ErrUnknownSymbol)
+	}
+}
+
+func TestEncoderBudget(t *testing.T) {
+
+	// a dyadic distribution with an entropy of 1.75 bits
+	counts := []int{40, 20, 10, 10}
+
+	if h := Entropy(counts); math.Abs(h-1.75) > 1e-9 {
+		t.Errorf("Entropy = %f, want 1.75", h)
+	}
+
+	// the EOF leaf pushes the code lengths to 1, 2, 3, 4
+	e, err := NewEncoderBudget(counts, 1.9)
+	if err != nil {
+		t.Fatalf("feasible budget: %v", err)
+	}
+	if !bytes.Equal(e.CodebookBytes(), NewEncoder(counts).CodebookBytes()) {
+		t.Errorf("budget encoder differs from NewEncoder")
+	}
+
+	if _, err := NewEncoderBudget(counts, 1.8); err != ErrBudget {
+		t.Errorf("budget below code length: err = %v, want %v", err, ErrBudget)
+	}
+
+	if _, err := NewEncoderBudget(counts, 1.5); err != ErrBudget {
+		t.Errorf("budget below entropy: err = %v, want %v", err, ErrBudget)
+	}
+
+	// entropy is below 1 bit, but every code is at least 1 bit long
+	if _, err := NewEncoderBudget([]int{99, 1}, 0.5); err != ErrBudget {
+		t.Errorf("budget below 1 bit: err = %v, want %v", err, ErrBudget)
+	}
+}
+
+func TestDecoderCounted(t *testing.T) {
+
+	e := NewEncoder([]int{10, 6, 3, 1})
+	syms := []uint32{0, 1, 2, 3, 0, 0, 1}
+	data := encodeSymbols(e, syms)
+
+	d, err := NewDecoderCounted(e.CodebookBytesCounted(len(syms)))
+	if err != nil {
+		t.Fatalf("NewDecoderCounted: %v", err)
+	}
+	if got, err := d.DecodeBytes(data); err != nil || len(got) != len(syms) {
+		t.Errorf("matching count: got %v (%v), want %v", got, err, syms)
+	}
+
+	for _, tt := range []struct {
+		total int
+		err   error
+	}{
+		{len(syms) + 1, ErrTruncated},
+		{len(syms) - 1, ErrSymbolCount},
+		{0, ErrSymbolCount},
+	} {
+		d, err := NewDecoderCounted(e.CodebookBytesCounted(tt.total))
+		if err != nil {
+			t.Fatalf("NewDecoderCounted(%d): %v", tt.total, err)
+		}
+		if _, err := d.DecodeBytes(data); err != tt.err {
+			t.Errorf("total %d: err = %v, want %v", tt.total, err, tt.err)
+		}
+
+		// every whole-stream decode checks the count
+		if _, err := d.DecodeAll(data, StrictTrailing); err != tt.err {
+			t.Errorf("total %d: DecodeAll err = %v, want %v", tt.total, err, tt.err)
+		}
+		if _, err := d.DecodeCapped(data, 100); err != tt.err {
+			t.Errorf("total %d: DecodeCapped err = %v, want %v", tt.total, err, tt.err)
+		}
+		if _, _, err := d.DecodeChecksum(data); err != tt.err {
+			t.Errorf("total %d: DecodeChecksum err = %v, want %v", tt.total, err, tt.err)
+		}
+	}
+
+	// the plain format has no count
+	if _, err := NewDecoderCounted(e.CodebookBytes()); err != ErrInvalidCodebook {
+		t.Errorf("uncounted codebook: err = %v, want %v", err, ErrInvalidCodebook)
+	}
+
+	// NewDecoder recognises the counted format and checks the count too
+	d, err = NewDecoder(e.CodebookBytesCounted(len(syms) - 1))
+	if err != nil {
+		t.Fatalf("NewDecoder(counted): %v", err)
+	}
+	if _, err := d.DecodeBytes(data); err != ErrSymbolCount {
+		t.Errorf("NewDecoder(counted): err = %v, want %v", err, ErrSymbolCount)
+	}
+
+	// and rejects versions it doesn't know
+	cb := e.CodebookBytesCounted(len(syms))
+	cb[1] = 2
+	if _, err := NewDecoder(cb); err != ErrInvalidCodebook {
+		t.Errorf("unknown version: err = %v, want %v", err, ErrInvalidCodebook)
+	}
+
+	if _, err := NewDecoder([]byte{0xff, 0xff, 0x03, 1, 1}); err != ErrInvalidCodebook {
+		t.Errorf("oversized length table: err = %v, want %v", err, ErrInvalidCodebook)
+	}
+}
+
+func TestDecodeLengthHistogram(t *testing.T) {
+
+	counts := []int{40, 22, 10, 10, 3, 1, 1}
+	e := NewEncoder(counts)
+
+	var syms []uint32
+	for i, v := range counts {
+		for j := 0; j < v; j++ {
+			syms = append(syms, uint32(i))
+		}
+	}
+
+	got, err := e.Decoder().DecodeLengthHistogram(encodeSymbols(e, syms))
+	if err != nil {
+		t.Fatalf("DecodeLengthHistogram: %v", err)
+	}
+
+	want := e.LengthHistogram(counts)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	var n int64
+	for l := range want {
+		if got[l] != want[l] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+		n += got[l]
+	}
+	if n != int64(len(syms)+1) {
+		t.Errorf("histogram counts %d codes, want %d", n, len(syms)+1)
+	}
+}
+
+func TestRedundancy(t *testing.T) {
+
+	dyadic := make([]int, 12)
+	for i := range dyadic {
+		dyadic[i] = 1 << uint(len(dyadic)-1-i)
+	}
+	dyadic[len(dyadic)-1] = 2
+
+	e := NewEncoder(dyadic)
+	if r := e.Redundancy(dyadic); r < 0 || r > 0.01 {
+		t.Errorf("dyadic redundancy = %f, want near 0", r)
+	}
+	if r, want := e.Redundancy(dyadic), e.ExpectedBitsPerSymbol()-Entropy(dyadic); math.Abs(r-want) > 1e-9 {
+		t.Errorf("Redundancy = %f, ExpectedBitsPerSymbol - Entropy = %f", r, want)
+	}
+
+	skewed := []int{99, 1}
+	if r := NewEncoder(skewed).Redundancy(skewed); r < 0.5 {
+		t.Errorf("skewed redundancy = %f, want > 0.5", r)
+	}
+}
+
+func TestPeekDepth(t *testing.T) {
+
+	counts := make([]int, 200)
+	for i := range counts {
+		counts[i] = 100000 / (i + 1)
+	}
+
+	e := NewEncoder(counts)
+	min, p90 := e.Decoder().PeekDepth(counts)
+
+	if min != e.SymbolLen(0) {
+		t.Errorf("minBits = %d, want %d", min, e.SymbolLen(0))
+	}
+
+	max := maxSymbolLen(e, len(counts))
+	if p90 < min || p90 > max {
+		t.Errorf("p90Bits = %d, want between %d and %d", p90, min, max)
+	}
+
+	var total, within, below int
+	for i, v := range counts {
+		total += v
+		if l := e.SymbolLen(uint32(i)); l <= p90 {
+			within += v
+		}
+		if l := e.SymbolLen(uint32(i)); l < p90 {
+			below += v
+		}
+	}
+	if within*10 < total*9 {
+		t.Errorf("%d bits resolves only %d of %d symbols", p90, within, total)
+	}
+	if below*10 >= total*9 {
+		t.Errorf("%d bits already resolves 90%% of symbols", p90-1)
+	}
+
+	for _, c := range [][]int{nil, make([]int, 200)} {
+		if m, p := e.Decoder().PeekDepth(c); m != min || p != min {
+			t.Errorf("PeekDepth(%d zero counts) = %d, %d, want %d, %d", len(c), m, p, min, min)
+		}
+	}
+}
+
+func TestEncoderOrFixed(t *testing.T) {
+
+	counts := []int{10, 5, 5, 1}
+	if !bytes.Equal(NewEncoderOrFixed(counts).CodebookBytes(), NewEncoder(counts).CodebookBytes()) {
+		t.Errorf("normal counts didn't give the optimal codebook")
+	}
+
+	for _, counts := range [][]int{nil, make([]int, 256)} {
+		e := NewEncoderOrFixed(counts)
+
+		for s := uint32(0); s < 255; s++ {
+			if l := e.SymbolLen(s); l != 8 {
+				t.Fatalf("fixed code for %d has length %d", s, l)
+			}
+		}
+		if l := e.SymbolLen(255); l != 9 {
+			t.Errorf("fixed code for 255 has length %d", l)
+		}
+		if l := e.SymbolLen(EOF); l != 9 {
+			t.Errorf("fixed code for EOF has length %d", l)
+		}
+
+		syms := []uint32{0, 255, 128, 7, 254}
+		d, err := NewDecoder(e.CodebookBytes())
+		if err != nil {
+			t.Fatalf("NewDecoder: %v", err)
+		}
+		got, err := d.DecodeBytes(encodeSymbols(e, syms))
+		if err != nil || len(got) != len(syms) {
+			t.Fatalf("got %v (%v), want %v", got, err, syms)
+		}
+		for i := range syms {
+			if got[i] != syms[i] {
+				t.Fatalf("got %v, want %v", got, syms)
+			}
+		}
+	}
+
+	// fibonacci weights need codes longer than 32 bits
+	fib := make([]int, 50)
+	fib[0], fib[1] = 1, 1
+	for i := 2; i < len(fib); i++ {
+		fib[i] = fib[i-1] + fib[i-2]
+	}
+	if l := NewEncoderOrFixed(fib).SymbolLen(0); l != 8 {
+		t.Errorf("fibonacci counts: code length %d, want the fixed 8", l)
+	}
+}
+
+func TestDecodeFixed(t *testing.T) {
+
+	e := NewEncoder([]int{8, 4, 2, 1})
+	syms := []uint32{0, 1, 2, 3, 0, 1}
+	data := encodeSymbols(e, syms)
+	d := e.Decoder()
+
+	var dst [6]uint32
+	n, err := d.DecodeFixed(bitstream.NewReader(bytes.NewReader(data)), dst[:])
+	if err != nil || n != len(syms) {
+		t.Fatalf("DecodeFixed = %d, %v; want %d, nil", n, err, len(syms))
+	}
+	for i := range syms {
+		if dst[i] != syms[i] {
+			t.Fatalf("got %v, want %v", dst, syms)
+		}
+	}
+
+	var small [4]uint32
+	n, err = d.DecodeFixed(bitstream.NewReader(bytes.NewReader(data)), small[:])
+	if err != io.ErrShortBuffer || n != len(small) {
+		t.Errorf("small buffer: DecodeFixed = %d, %v; want %d, %v", n, err, len(small), io.ErrShortBuffer)
+	}
+
+	// reset the input for each run, draining the bits left over from the last one
+	rd := bytes.NewReader(nil)
+	br := bitstream.NewReader(rd)
+	allocs := testing.AllocsPerRun(1, func() {
+		rd.Reset(data)
+		if n, err := d.DecodeFixed(br, dst[:]); err != nil || n != len(syms) {
+			t.Errorf("reset input: DecodeFixed = %d, %v; want %d, nil", n, err, len(syms))
+		}
+		for {
+			if _, err := br.ReadBit(); err != nil {
+				break
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("DecodeFixed allocated %v times", allocs)
+	}
+}
+
+func TestTableHitRate(t *testing.T) {
+
+	// lengths 1, 2, 3, 4, 5, 6, 6 (EOF)
+	e := NewEncoder([]int{32, 16, 8, 4, 2, 1})
+	d := e.Decoder()
+
+	// 6 codes of at most 2 bits, 2 of 3 to 5 bits, and 3 of 6 bits including EOF
+	data := encodeSymbols(e, []uint32{0, 0, 1, 5, 0, 4, 1, 3, 1, 5})
+
+	for _, tt := range []struct {
+		maxBits int
+		want    float64
+	}{
+		{0, 0},
+		{2, 6.0 / 11},
+		{5, 8.0 / 11},
+		{6, 1},
+	} {
+		got, err := d.TableHitRate(data, tt.maxBits)
+		if err != nil {
+			t.Fatalf("TableHitRate(%d): %v", tt.maxBits, err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("TableHitRate(%d) = %f, want %f", tt.maxBits, got, tt.want)
+		}
+	}
+}
+
+func TestPruningCandidates(t *testing.T) {
+
+	counts := []int{500, 3, 120, 0, 1, 60, 2, 250, 1, 30}
+	e := NewEncoder(counts)
+
+	const keep = 5
+	drop := e.PruningCandidates(counts, keep)
+
+	if want := 9 - keep; len(drop) != want {
+		t.Fatalf("dropped %v, want %d symbols", drop, want)
+	}
+
+	dropped := make(map[uint32]bool)
+	for _, s := range drop {
+		dropped[s] = true
+	}
+
+	bits := func(s int) int64 { return int64(counts[s]) * int64(e.SymbolLen(uint32(s))) }
+
+	for i := range counts {
+		if counts[i] == 0 || !dropped[uint32(i)] {
+			continue
+		}
+		for j := range counts {
+			if counts[j] != 0 && !dropped[uint32(j)] && bits(i) > bits(j) {
+				t.Errorf("dropped %d (%d bits) but kept %d (%d bits)", i, bits(i), j, bits(j))
+			}
+		}
+	}
+
+	if drop := e.PruningCandidates(counts, 20); len(drop) != 0 {
+		t.Errorf("keeping everything dropped %v", drop)
+	}
+}
+
+func TestByteAlignment(t *testing.T) {
+
+	// lengths 1, 2, 3, 4, 4 (EOF)
+	e := NewEncoder([]int{16, 8, 4, 2})
+
+	for _, tt := range []struct {
+		syms    []uint32
+		aligned []bool
+	}{
+		{[]uint32{0, 0, 0, 0, 0, 0, 0, 0}, []bool{false, false, false, false, false, false, false, true}},
+		{[]uint32{3, 3, 2, 1, 1}, []bool{false, true, false, false, false}},
+		{[]uint32{3, 3, 2, 1, 2}, []bool{false, true, false, false, true}},
+		{[]uint32{3, EOF}, []bool{false, true}},
+		{nil, nil},
+	} {
+		got := e.ByteAlignment(tt.syms)
+		if len(got) != len(tt.aligned) {
+			t.Fatalf("ByteAlignment(%v) = %v, want %v", tt.syms, got, tt.aligned)
+		}
+		for i := range got {
+			if got[i] != tt.aligned[i] {
+				t.Errorf("ByteAlignment(%v) = %v, want %v", tt.syms, got, tt.aligned)
+				break
+			}
+		}
+
+		want := len(tt.syms) == 0 || tt.aligned[len(tt.aligned)-1]
+		if e.IsByteAligned(tt.syms) != want {
+			t.Errorf("IsByteAligned(%v) = %v, want %v", tt.syms, !want, want)
+		}
+	}
+}
+
+func TestEncoderFromLengths(t *testing.T) {
+
+	// DEFLATE allows a single distance code of length 1
+	e, err := NewEncoderFromLengths([]int{0, 0, 0, 1, 0})
+	if err != nil {
+		t.Fatalf("single code: %v", err)
+	}
+
+	syms := []uint32{3, 3, 3}
+
+	var b bytes.Buffer
+	w := e.Writer(&b)
+	for _, s := range syms {
+		if _, err := w.WriteSymbol(s); err != nil {
+			t.Fatalf("WriteSymbol(%d): %v", s, err)
+		}
+	}
+	w.Close()
+
+	d, err := NewDecoderNoEOF(e.CodebookBytes())
+	if err != nil {
+		t.Fatalf("NewDecoderNoEOF: %v", err)
+	}
+
+	br := bitstream.NewReader(bytes.NewReader(b.Bytes()))
+	for i, want := range syms {
+		if got, err := d.ReadSymbol(br); err != nil || got != want {
+			t.Fatalf("symbol %d: got %d (%v), want %d", i, got, err, want)
+		}
+	}
+
+	// the unused code
+	if _, err := d.ReadSymbol(bitstream.NewReader(bytes.NewReader([]byte{0x80}))); err != ErrUnknownSymbol {
+		t.Errorf("unused code: err = %v, want %v", err, ErrUnknownSymbol)
+	}
+
+	if _, err := NewEncoderFromLengths([]int{2, 1, 3, 3}); err != nil {
+		t.Errorf("complete code: %v", err)
+	}
+
+	for _, lengths := range [][]int{
+		{0, 2},
+		{1, 2},
+		{1, 1, 1},
+		{0, 0},
+	} {
+		if _, err := NewEncoderFromLengths(lengths); err != ErrInvalidCodebook {
+			t.Errorf("lengths %v: err = %v, want %v", lengths, err, ErrInvalidCodebook)
+		}
+	}
+}
+
+func TestDecodeLatencyStats(t *testing.T) {
+
+	counts := []int{1000, 500, 250, 1}
+	e := NewEncoder(counts)
+	d := e.Decoder()
+
+	var syms []uint32
+	for i := 0; i < 100; i++ {
+		syms = append(syms, 0)
+	}
+	syms = append(syms, 3)
+
+	max, avg, err := d.DecodeLatencyStats(encodeSymbols(e, syms))
+	if err != nil {
+		t.Fatalf("DecodeLatencyStats: %v", err)
+	}
+
+	if max != e.SymbolLen(3) {
+		t.Errorf("maxReads = %d, want %d", max, e.SymbolLen(3))
+	}
+	if avg != 1 {
+		t.Errorf("avgReads = %d, want 1", avg)
+	}
+
+	max, avg, err = d.DecodeLatencyStats(encodeSymbols(e, []uint32{1, 1}))
+	if err != nil || max != e.SymbolLen(EOF) || avg != 3 {
+		t.Errorf("DecodeLatencyStats = %d, %d, %v; want %d, 3, nil", max, avg, err, e.SymbolLen(EOF))
+	}
+}
+
+func TestDecodeExpect(t *testing.T) {
+
+	e := NewEncoder([]int{5, 4, 3})
+	syms := []uint32{0, 1, 2, 2, 1, 0, 0}
+	data := encodeSymbols(e, syms)
+	d := e.Decoder()
+
+	if got, err := d.DecodeExpect(data, len(syms)); err != nil || len(got) != len(syms) {
+		t.Errorf("correct count: got %v (%v), want %v", got, err, syms)
+	}
+
+	if _, err := d.DecodeExpect(data, len(syms)+2); err != ErrTruncated {
+		t.Errorf("expected more: err = %v, want %v", err, ErrTruncated)
+	}
+
+	if _, err := d.DecodeExpect(data, 3); err != ErrSymbolCount {
+		t.Errorf("expected fewer: err = %v, want %v", err, ErrSymbolCount)
+	}
+}
+
+func TestDecoderMmap(t *testing.T) {
+
+	// a sparse alphabet of 2^20 symbols, every 8th of which is used, plus EOF
+	const n = 1 << 20
+	lengths := make([]int, n+1)
+	for i := 0; i < n; i += 8 {
+		lengths[i] = 17
+	}
+	lengths[0], lengths[n] = 18, 18
+
+	cb, _ := makeCodebook(lengths).MarshalBinary()
+
+	d, err := NewDecoderMmap(cb)
+	if err != nil {
+		t.Fatalf("NewDecoderMmap: %v", err)
+	}
+
+	want, err := NewDecoder(cb)
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+
+	if d.eof != want.eof || len(d.numl) != len(want.numl) || len(d.sym) != len(want.sym) {
+		t.Fatalf("tables differ: eof %d/%d numl %v/%v syms %d/%d", d.eof, want.eof, d.numl, want.numl, len(d.sym), len(want.sym))
+	}
+	for i := range d.numl {
+		if d.numl[i] != want.numl[i] {
+			t.Fatalf("numl = %v, want %v", d.numl, want.numl)
+		}
+	}
+	for i := range d.sym {
+		if *d.sym[i] != *want.sym[i] {
+			t.Fatalf("sym[%d] = %+v, want %+v", i, *d.sym[i], *want.sym[i])
+		}
+	}
+
+	codes := make(map[uint32]*symbol)
+	for _, s := range want.sym {
+		codes[s.s] = s
+	}
+
+	syms := []uint32{0, 8, 1 << 19, n - 8, 16, 0}
+	var b bytes.Buffer
+	w := bitstream.NewWriter(&b)
+	for _, s := range append(syms, n) {
+		w.WriteBits(uint64(codes[s].code), codes[s].length)
+	}
+	w.Flush(bitstream.Zero)
+
+	got, err := d.DecodeBytes(b.Bytes())
+	if err != nil || len(got) != len(syms) {
+		t.Fatalf("DecodeBytes = %v (%v), want %v", got, err, syms)
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Errorf("DecodeBytes = %v, want %v", got, syms)
+			break
+		}
+	}
+
+	// more symbols than a uint32 can number
+	huge := binary.AppendUvarint(nil, 1<<32)
+
+	for _, bad := range [][]byte{nil, {0}, {3, 1}, {3, 1, 1, 1}, {1, 33}, append(huge, 1, 1)} {
+		if _, err := NewDecoderMmap(bad); err != ErrInvalidCodebook {
+			t.Errorf("NewDecoderMmap(%v) err = %v, want %v", bad, err, ErrInvalidCodebook)
+		}
+	}
+}
+
+func makeCodebook(lengths []int) codebook {
+	c := make(codebook, len(lengths))
+	for i, l := range lengths {
+		c[i] = symbol{s: uint32(i), length: l}
+	}
+	return c
+}
+
+func TestGini(t *testing.T) {
+
+	uniform := make([]int, 100)
+	skewed := make([]int, 100)
+	for i := range uniform {
+		uniform[i] = 50
+		skewed[i] = 1
+	}
+	skewed[7] = 1000000
+
+	if g := NewEncoder(uniform).Gini(); math.Abs(g) > 1e-9 {
+		t.Errorf("uniform Gini = %v, want 0", g)
+	}
+
+	if g := NewEncoder(skewed).Gini(); g < 0.98 || g > 1 {
+		t.Errorf("skewed Gini = %v, want near 1", g)
+	}
+
+	if g := NewEncoder([]int{1, 2, 3, 4}).Gini(); math.Abs(g-0.25) > 1e-9 {
+		t.Errorf("Gini = %v, want 0.25", g)
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+
+	text := []byte("hello, hello")
+	counts := make([]int, 256)
+	var syms []uint32
+	for _, c := range text {
+		counts[c]++
+		syms = append(syms, uint32(c))
+	}
+	e := NewEncoder(counts)
+	data := encodeSymbols(e, syms)
+
+	got, crc, err := e.Decoder().DecodeChecksum(data)
+	if err != nil || len(got) != len(text) {
+		t.Fatalf("DecodeChecksum = %v (%v), want %q", got, err, text)
+	}
+	if want := crc32.ChecksumIEEE(text); crc != want {
+		t.Errorf("crc = %08x, want %08x", crc, want)
+	}
+
+	if _, _, err := e.Decoder().DecodeChecksum(data[:1]); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	wide := NewEncoder(append(make([]int, 299), 1))
+	if _, _, err := wide.Decoder().DecodeChecksum(encodeSymbols(wide, []uint32{299})); err != ErrSymbolRange {
+		t.Errorf("symbol 299: err = %v, want %v", err, ErrSymbolRange)
+	}
+}
+
+func TestDecoderFromLengths(t *testing.T) {
+
+	e := NewEncoder([]int{10, 0, 3, 7, 1, 0, 2})
+	syms := []uint32{0, 2, 3, 6, 4, 0, 0, 3}
+	data := encodeSymbols(e, syms)
+
+	var sent int
+	lengths := func(yield func(int) bool) {
+		for i := range e.m {
+			sent++
+			if !yield(e.m[i].length) {
+				return
+			}
+		}
+	}
+
+	d, err := NewDecoderFromLengths(lengths)
+	if err != nil {
+		t.Fatalf("NewDecoderFromLengths: %v", err)
+	}
+	if sent != len(e.m) {
+		t.Errorf("consumed %d lengths, want %d", sent, len(e.m))
+	}
+
+	got, err := d.DecodeBytes(data)
+	if err != nil || len(got) != len(syms) {
+		t.Fatalf("DecodeBytes = %v (%v), want %v", got, err, syms)
+	}
+	for i := range syms {
+		if got[i] != syms[i] {
+			t.Fatalf("DecodeBytes = %v, want %v", got, syms)
+		}
+	}
+
+	for _, bad := range [][]int{nil, {0, 0}, {1, 1, 1}, {1, 33}, {-1, 1}} {
+		if _, err := NewDecoderFromLengths(slices.Values(bad)); err != ErrInvalidCodebook {
+			t.Errorf("NewDecoderFromLengths(%v) err = %v, want %v", bad, err, ErrInvalidCodebook)
+		}
+	}
+}
+
+func TestBalanceFactor(t *testing.T) {
+
+	uniform := make([]int, 63)
+	for i := range uniform {
+		uniform[i] = 100
+	}
+	if f := NewEncoder(uniform).BalanceFactor(); f < 1 || f > 1.01 {
+		t.Errorf("uniform BalanceFactor = %v, want near 1", f)
+	}
+
+	if f := NewEncoder(fibCounts(20)).BalanceFactor(); f < 2 {
+		t.Errorf("skewed BalanceFactor = %v, want > 2", f)
+	}
+
+	if f := NewEncoder(nil).BalanceFactor(); f != 1 {
+		t.Errorf("EOF only BalanceFactor = %v, want 1", f)
+	}
+}
+
+func TestDecodeTyped(t *testing.T) {
+
+	counts := make([]int, 300)
+	counts[1], counts[65], counts[255], counts[299] = 4, 3, 2, 1
+	e := NewEncoder(counts)
+	d := e.Decoder()
+
+	syms := []uint32{1, 65, 255, 1, 65, 1}
+	got, err := DecodeTyped[byte](d, encodeSymbols(e, syms))
+	if err != nil || string(got) != "\x01A\xff\x01A\x01" {
+		t.Errorf("DecodeTyped[byte] = %q (%v), want %q", got, err, "\x01A\xff\x01A\x01")
+	}
+
+	if _, err := DecodeTyped[byte](d, encodeSymbols(e, []uint32{1, 299})); err != ErrSymbolRange {
+		t.Errorf("overflow: err = %v, want %v", err, ErrSymbolRange)
+	}
+
+	if _, err := DecodeTyped[int8](d, encodeSymbols(e, []uint32{255})); err != ErrSymbolRange {
+		t.Errorf("signed overflow: err = %v, want %v", err, ErrSymbolRange)
+	}
+
+	syms = append(syms, 299)
+	wide, err := DecodeTyped[uint32](d, encodeSymbols(e, syms))
+	if err != nil || !slices.Equal(wide, syms) {
+		t.Errorf("DecodeTyped[uint32] = %v (%v), want %v", wide, err, syms)
+	}
+}
+
+func TestBreakEvenSymbols(t *testing.T) {
+
+	// lengths 1, 2, 3, 4 and EOF 4: 1.875 bits per symbol against 2 raw,
+	// and a 6 byte codebook
+	counts := []int{8, 4, 2, 2}
+	e := NewEncoder(counts)
+	if e.CodebookSize() != 6 || e.SymbolLen(EOF) != 4 {
+		t.Fatalf("codebook size %d, EOF length %d, want 6 and 4", e.CodebookSize(), e.SymbolLen(EOF))
+	}
+
+	n := e.BreakEvenSymbols(counts)
+	if n != (6*8+4)*8 {
+		t.Errorf("BreakEvenSymbols = %d, want %d", n, (6*8+4)*8)
+	}
+
+	// scaling counts to n+16 symbols makes the huffman code strictly better
+	scaled := func(k int) []int {
+		return []int{8 * k, 4 * k, 2 * k, 2 * k}
+	}
+	if k := n/16 + 1; e.EncodedBits(scaled(k))+int64(e.CodebookSize()*8) >= int64(2*16*k) {
+		t.Errorf("%d symbols: huffman not smaller than raw", 16*k)
+	}
+	if k := n / 16; e.EncodedBits(scaled(k))+int64(e.CodebookSize()*8) < int64(2*16*k) {
+		t.Errorf("%d symbols: huffman smaller than raw", 16*k)
+	}
+
+	if n := NewEncoder([]int{5, 5, 5, 5}).BreakEvenSymbols([]int{5, 5, 5, 5}); n != -1 {
+		t.Errorf("uniform BreakEvenSymbols = %d, want -1", n)
+	}
+}
+
+func TestEncoderReservoir(t *testing.T) {
+
+	// roughly geometric bytes, with a few rare ones the sample will miss
+	rnd := rand.New(rand.NewSource(7))
+	data := make([]byte, 1<<20)
+	for i := range data {
+		b := 0
+		for b < 40 && rnd.Intn(3) == 0 {
+			b++
+		}
+		data[i] = byte(b)
+	}
+	data[1000], data[500000] = 200, 201
+
+	counts := make([]int, 256)
+	for _, b := range data {
+		counts[b]++
+	}
+
+	e, err := NewEncoderReservoir(bytes.NewReader(data), 10000)
+	if err != nil {
+		t.Fatalf("NewEncoderReservoir: %v", err)
+	}
+
+	for b, v := range counts {
+		if v != 0 && e.SymbolLen(uint32(b)) == 0 {
+			t.Errorf("byte %d occurs but has no code", b)
+		}
+	}
+
+	got, want := e.EncodedBits(counts), NewEncoder(counts).EncodedBits(counts)
+	if float64(got) > float64(want)*1.02 {
+		t.Errorf("reservoir encoding = %d bits, want within 2%% of %d", got, want)
+	}
+
+	if _, err := NewEncoderReservoir(bytes.NewReader(data), 0); err != ErrSampleSize {
+		t.Errorf("sample size 0: err = %v, want %v", err, ErrSampleSize)
+	}
+}
+
+func TestRunLengthCandidates(t *testing.T) {
+
+	data := strings.Repeat("a", 900) + strings.Repeat("b", 60) + "cdefgh" + strings.Repeat("c", 34)
+	counts := make([]int, 256)
+	for i := 0; i < len(data); i++ {
+		counts[data[i]]++
+	}
+	e := NewEncoder(counts)
+
+	if got := e.RunLengthCandidates(0.5); !slices.Equal(got, []uint32{'a'}) {
+		t.Errorf("RunLengthCandidates(0.5) = %v, want [%d]", got, 'a')
+	}
+
+	if got := e.RunLengthCandidates(0.05); !slices.Equal(got, []uint32{'a', 'b'}) {
+		t.Errorf("RunLengthCandidates(0.05) = %v, want [%d %d]", got, 'a', 'b')
+	}
+
+	if got := e.RunLengthCandidates(0.95); len(got) != 0 {
+		t.Errorf("RunLengthCandidates(0.95) = %v, want none", got)
+	}
+
+	// every symbol in use, once each, and not the unused ones
+	want := []uint32{'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h'}
+	if got := e.RunLengthCandidates(-1); !slices.Equal(got, want) {
+		t.Errorf("RunLengthCandidates(-1) = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeCapped(t *testing.T) {
+
+	// a one bit code makes a small stream of many symbols
+	e := NewEncoder([]int{1000, 1})
+	syms := make([]uint32, 10000)
+	data := encodeSymbols(e, syms)
+	d := e.Decoder()
+
+	got, err := d.DecodeCapped(data, 100)
+	if err != ErrCapExceeded {
+		t.Errorf("err = %v, want %v", err, ErrCapExceeded)
+	}
+	if len(got) != 100 {
+		t.Errorf("decoded %d symbols, want 100", len(got))
+	}
+
+	if got, err := d.DecodeCapped(data, len(syms)); err != nil || len(got) != len(syms) {
+		t.Errorf("at cap: decoded %d symbols (%v), want %d", len(got), err, len(syms))
+	}
+}
+
+func TestDecodeAllStrictTrailing(t *testing.T) {
+
+	e := NewEncoder([]int{5, 4, 3})
+	syms := []uint32{0, 1, 2, 0}
+	data := encodeSymbols(e, syms)
+	d := e.Decoder()
+
+	if e.EncodedBits([]int{2, 1, 1})%8 == 0 {
+		t.Fatalf("test stream has no padding")
+	}
+
+	if got, err := d.DecodeAll(data, StrictTrailing); err != nil || !slices.Equal(got, syms) {
+		t.Errorf("clean padding: got %v (%v), want %v", got, err, syms)
+	}
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-1] |= 1
+	appended := append(append([]byte(nil), data...), 0)
+
+	for name, bad := range map[string][]byte{"trailing one": flipped, "extra byte": appended} {
+		if _, err := d.DecodeAll(bad, StrictTrailing); err != ErrTrailingData {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrTrailingData)
+		}
+		if got, err := d.DecodeAll(bad); err != nil || !slices.Equal(got, syms) {
+			t.Errorf("%s, not strict: got %v (%v), want %v", name, got, err, syms)
+		}
+	}
+}
+
+func TestThroughputEstimate(t *testing.T) {
+
+	var prev float64
+	for _, n := range []int{3, 15, 63, 255} {
+		counts := make([]int, n)
+		for i := range counts {
+			counts[i] = 1
+		}
+		d := NewEncoder(counts).Decoder()
+
+		est := d.ThroughputEstimate()
+		if got := est * d.ExpectedReadsPerSymbol(nil); math.Abs(got-decodeBitsPerSecond) > 1e-3 {
+			t.Errorf("%d symbols: estimate * bits per symbol = %v, want %v", n, got, float64(decodeBitsPerSecond))
+		}
+		if prev != 0 && est >= prev {
+			t.Errorf("%d symbols: estimate %v not below %v for shorter codes", n, est, prev)
+		}
+		prev = est
+	}
+}
+
+func TestEncoderAliased(t *testing.T) {
+
+	// tab and no-break space are both written as a space
+	counts := make([]int, 256)
+	counts[' '], counts['\t'], counts[0xa0], counts['x'], counts['y'] = 10, 5, 3, 8, 2
+	aliases := map[uint32]uint32{'\t': ' ', 0xa0: ' '}
+
+	e, err := NewEncoderAliased(counts, aliases)
+	if err != nil {
+		t.Fatalf("NewEncoderAliased: %v", err)
+	}
+
+	if l := e.SymbolLen('\t'); l == 0 || l != e.SymbolLen(' ') {
+		t.Errorf("alias length %d, target length %d", l, e.SymbolLen(' '))
+	}
+	if n := e.CommonPrefixLen('\t', ' '); n != e.SymbolLen(' ') {
+		t.Errorf("CommonPrefixLen(alias, target) = %d, want %d", n, e.SymbolLen(' '))
+	}
+	if n := e.CommonPrefixLen('\t', 0xa0); n != e.SymbolLen(' ') {
+		t.Errorf("CommonPrefixLen(alias, alias) = %d, want %d", n, e.SymbolLen(' '))
+	}
+
+	// the same codebook with a different alias decodes differently
+	other, _ := NewEncoderAliased(counts, map[uint32]uint32{'\t': ' ', 0xa0: ' '})
+	other.alias[0xa0] = 'x'
+	if e.CodebookHash() == other.CodebookHash() {
+		t.Errorf("different aliases hash equal")
+	}
+	if same, _ := NewEncoderAliased(counts, aliases); same.CodebookHash() != e.CodebookHash() {
+		t.Errorf("same aliases hash differently")
+	}
+
+	if e.m['\t'].length != 0 || e.m[' '].weight != 18 {
+		t.Errorf("alias has its own code, or target weight %d, want 18", e.m[' '].weight)
+	}
+
+	in := []uint32{'x', '\t', 'y', 0xa0, ' ', 'x'}
+	want := []uint32{'x', ' ', 'y', ' ', ' ', 'x'}
+	got, err := e.Decoder().DecodeBytes(encodeSymbols(e, in))
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("DecodeBytes = %v (%v), want %v", got, err, want)
+	}
+
+	// a plain encoder keeps the symbols apart until DecodeAliased merges them
+	plain := NewEncoder(counts)
+	got, err = plain.Decoder().DecodeAliased(encodeSymbols(plain, in), aliases)
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("DecodeAliased = %v (%v), want %v", got, err, want)
+	}
+
+	if _, err := NewEncoderAliased(counts, map[uint32]uint32{'a': 'b', 'b': 'c'}); err != ErrAliasChain {
+		t.Errorf("chain: err = %v, want %v", err, ErrAliasChain)
+	}
+	if _, err := NewEncoderAliased(counts, map[uint32]uint32{'a': 256}); err != ErrSymbolRange {
+		t.Errorf("out of range: err = %v, want %v", err, ErrSymbolRange)
+	}
+}
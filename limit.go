@@ -0,0 +1,130 @@
+package huff
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+var ErrMaxLen = errors.New("huff: too many symbols for maximum code length")
+
+// pmItem is a coin in the package-merge algorithm: a leaf, or a package of two items
+type pmItem struct {
+	weight int
+	leaf   *node
+	child  [2]*pmItem
+}
+
+// count adds the number of times each leaf appears below it to m's lengths
+func (p *pmItem) count(m codebook) {
+	if p.leaf != nil {
+		m[p.leaf.sym].length++
+		return
+	}
+	p.child[0].count(m)
+	p.child[1].count(m)
+}
+
+// NewEncoderLimited is like NewEncoder, but uses the package-merge algorithm
+// to build the optimal code in which no code is longer than maxLen bits.
+func NewEncoderLimited(counts []int, maxLen int) (*Encoder, error) {
+	var leaves []*node
+	for i, v := range counts {
+		if v != 0 {
+			leaves = append(leaves, &node{weight: v, leaf: true, sym: uint32(i)})
+		}
+	}
+
+	// one more for EOF
+	eof := uint32(len(counts))
+	leaves = append(leaves, &node{weight: 0, leaf: true, sym: eof})
+
+	if maxLen < 1 || maxLen < 63 && len(leaves) > 1<<uint(maxLen) {
+		return nil, ErrMaxLen
+	}
+
+	sort.Slice(leaves, func(i, j int) bool {
+		return leaves[i].weight < leaves[j].weight || leaves[i].weight == leaves[j].weight && leaves[i].sym < leaves[j].sym
+	})
+
+	m := make(codebook, eof+1)
+	for _, l := range leaves {
+		m[l.sym] = symbol{s: l.sym, weight: l.weight}
+	}
+
+	if len(leaves) == 1 {
+		m[eof].length = 1
+	} else {
+		coins := make([]*pmItem, len(leaves))
+		for i, l := range leaves {
+			coins[i] = &pmItem{weight: l.weight, leaf: l}
+		}
+
+		list := coins
+		for l := 1; l < maxLen && len(list) > 1; l++ {
+			var packages []*pmItem
+			for i := 0; i+1 < len(list); i += 2 {
+				packages = append(packages, &pmItem{weight: list[i].weight + list[i+1].weight, child: [2]*pmItem{list[i], list[i+1]}})
+			}
+
+			// merge, with leaves before packages of the same weight
+			merged := make([]*pmItem, 0, len(coins)+len(packages))
+			i, j := 0, 0
+			for i < len(coins) || j < len(packages) {
+				if j == len(packages) || i < len(coins) && coins[i].weight <= packages[j].weight {
+					merged = append(merged, coins[i])
+					i++
+				} else {
+					merged = append(merged, packages[j])
+					j++
+				}
+			}
+			list = merged
+		}
+
+		for _, p := range list[:2*len(leaves)-2] {
+			p.count(m)
+		}
+	}
+
+	sptrs, numl := m.calculateCodes()
+
+	return &Encoder{eof: eof, m: m, sym: sptrs, numl: numl}, nil
+}
+
+// DefaultMaxCodeLen is the longest code CompressStream will use.
+const DefaultMaxCodeLen = 32
+
+// StreamStats describes the output of CompressStream.
+type StreamStats struct {
+	MaxLen      int   // the code length limit used
+	LongestCode int   // the longest code actually assigned
+	In, Out     int64 // bytes read and written
+}
+
+// CompressStream reads all of r and writes it to w in the format of Compress,
+// limiting codes to DefaultMaxCodeLen bits so the output is always decodable.
+func CompressStream(w io.Writer, r io.Reader) (StreamStats, error) {
+	return CompressStreamLimit(w, r, DefaultMaxCodeLen)
+}
+
+// CompressStreamLimit is CompressStream with codes limited to maxLen bits.
+func CompressStreamLimit(w io.Writer, r io.Reader, maxLen int) (StreamStats, error) {
+	st := StreamStats{MaxLen: maxLen}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return st, err
+	}
+	st.In = int64(len(data))
+
+	b, e, err := compress(data, maxLen)
+	if err != nil {
+		return st, err
+	}
+	st.LongestCode = len(e.numl) - 1
+
+	n, err := w.Write(b)
+	st.Out = int64(n)
+	return st, err
+}
@@ -0,0 +1,90 @@
+package huff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func fibCounts(n int) []int {
+	fib := make([]int, n)
+	fib[0], fib[1] = 1, 1
+	for i := 2; i < n; i++ {
+		fib[i] = fib[i-1] + fib[i-2]
+	}
+	return fib
+}
+
+func TestEncoderLimited(t *testing.T) {
+
+	fib := fibCounts(50)
+
+	if l := maxSymbolLen(NewEncoder(fib), len(fib)); l <= 32 {
+		t.Fatalf("unlimited fibonacci code only %d bits long", l)
+	}
+
+	e, err := NewEncoderLimited(fib, 32)
+	if err != nil {
+		t.Fatalf("NewEncoderLimited: %v", err)
+	}
+	if l := maxSymbolLen(e, len(fib)); l > 32 {
+		t.Errorf("limited code is %d bits long", l)
+	}
+	if l := e.SymbolLen(EOF); l == 0 || l > 32 {
+		t.Errorf("EOF code is %d bits long", l)
+	}
+
+	if _, err := NewDecoder(e.CodebookBytes()); err != nil {
+		t.Errorf("limited codebook invalid: %v", err)
+	}
+
+	// when the limit doesn't bind the code is optimal
+	counts := []int{40, 22, 10, 10, 3, 1, 1}
+	l, _ := NewEncoderLimited(counts, 32)
+	if got, want := l.EncodedBits(counts), NewEncoder(counts).EncodedBits(counts); got != want {
+		t.Errorf("unbound limit: %d bits, want %d", got, want)
+	}
+
+	if _, err := NewEncoderLimited([]int{1, 1, 1, 1, 1, 1, 1}, 3); err != nil {
+		t.Errorf("8 symbols in 3 bits: %v", err)
+	}
+	if _, err := NewEncoderLimited([]int{1, 1, 1, 1, 1, 1, 1, 1}, 3); err != ErrMaxLen {
+		t.Errorf("9 symbols in 3 bits: err = %v, want %v", err, ErrMaxLen)
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+
+	var data []byte
+	for i, v := range fibCounts(20) {
+		data = append(data, bytes.Repeat([]byte{byte('a' + i)}, v)...)
+	}
+
+	const maxLen = 10
+
+	var b bytes.Buffer
+	st, err := CompressStreamLimit(&b, bytes.NewReader(data), maxLen)
+	if err != nil {
+		t.Fatalf("CompressStreamLimit: %v", err)
+	}
+
+	if st.MaxLen != maxLen || st.LongestCode > maxLen || st.LongestCode == 0 {
+		t.Errorf("stats = %+v, want codes limited to %d bits", st, maxLen)
+	}
+	if st.In != int64(len(data)) || st.Out != int64(b.Len()) {
+		t.Errorf("stats = %+v, read %d and wrote %d", st, len(data), b.Len())
+	}
+
+	got, err := Decompress(b.Bytes())
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("round trip mismatch")
+	}
+
+	b.Reset()
+	st, err = CompressStream(&b, bytes.NewReader(data))
+	if err != nil || st.MaxLen != DefaultMaxCodeLen {
+		t.Errorf("CompressStream: %+v, %v", st, err)
+	}
+}
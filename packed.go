@@ -0,0 +1,116 @@
+package huff
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+const cacheLine = 64
+
+// alignUp rounds n up to a multiple of the cache line size
+func alignUp(n int) int {
+	return (n + cacheLine - 1) &^ (cacheLine - 1)
+}
+
+// PackTables returns the decoder's tables as a single blob: a one cache
+// line header holding the EOF symbol and the table sizes, followed by the
+// per-length counts, followed by (code, symbol) pairs.  Each table starts on
+// a cache line boundary, and the blob itself is cache line aligned in memory.
+// All values are little-endian uint32s.
+func (d *Decoder) PackTables() []byte {
+	numlOff := cacheLine
+	symOff := numlOff + alignUp(4*len(d.numl))
+	size := symOff + alignUp(8*len(d.sym))
+
+	buf := make([]byte, size+cacheLine)
+	off := int(-uintptr(unsafe.Pointer(&buf[0])) & (cacheLine - 1))
+	b := buf[off : off+size : off+size]
+
+	binary.LittleEndian.PutUint32(b[0:], d.eof)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(d.numl)))
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(d.sym)))
+
+	for i, n := range d.numl {
+		binary.LittleEndian.PutUint32(b[numlOff+4*i:], n)
+	}
+
+	for i, sym := range d.sym {
+		binary.LittleEndian.PutUint32(b[symOff+8*i:], sym.code)
+		binary.LittleEndian.PutUint32(b[symOff+8*i+4:], sym.s)
+	}
+
+	return b
+}
+
+// PackedDecoder decodes directly from tables produced by PackTables.
+type PackedDecoder struct {
+	eof  uint32
+	numl []byte
+	sym  []byte
+}
+
+// DecoderFromPacked returns a decoder reading from b, which must not be
+// modified while the decoder is in use.
+func DecoderFromPacked(b []byte) (*PackedDecoder, error) {
+	if len(b) < cacheLine {
+		return nil, ErrInvalidCodebook
+	}
+
+	eof := binary.LittleEndian.Uint32(b[0:])
+	nlen := int(binary.LittleEndian.Uint32(b[4:]))
+	nsym := int(binary.LittleEndian.Uint32(b[8:]))
+
+	numlOff := cacheLine
+	symOff := numlOff + alignUp(4*nlen)
+	if nlen < 2 || nsym == 0 || len(b) < symOff+8*nsym {
+		return nil, ErrInvalidCodebook
+	}
+
+	return &PackedDecoder{
+		eof:  eof,
+		numl: b[numlOff : numlOff+4*nlen],
+		sym:  b[symOff : symOff+8*nsym],
+	}, nil
+}
+
+func (d *PackedDecoder) ReadSymbol(br *bitstream.BitReader) (uint32, error) {
+	var offset uint32
+	var code uint32
+
+	nlen := len(d.numl) / 4
+	nsym := uint32(len(d.sym) / 8)
+
+	for i := 0; i+1 < nlen; i++ {
+		b, err := br.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+
+		code <<= 1
+		if b {
+			code |= 1
+		}
+
+		offset += binary.LittleEndian.Uint32(d.numl[4*i:])
+		if offset >= nsym {
+			break
+		}
+		first := binary.LittleEndian.Uint32(d.sym[8*offset:])
+
+		if code-first < binary.LittleEndian.Uint32(d.numl[4*(i+1):]) {
+			idx := code - first + offset
+			if idx >= nsym {
+				break
+			}
+			s := binary.LittleEndian.Uint32(d.sym[8*idx+4:])
+			if s == d.eof {
+				s = EOF
+			}
+			return s, nil
+		}
+	}
+
+	return 0, ErrUnknownSymbol
+}
@@ -0,0 +1,81 @@
+package huff
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+func packedTestData() (*Encoder, []uint32, []byte) {
+	counts := make([]int, 256)
+	var syms []uint32
+	for i := 0; i < 20000; i++ {
+		s := uint32((i*i + 3*i) % 251 % (1 + i%64))
+		syms = append(syms, s)
+		counts[s]++
+	}
+	e := NewEncoder(counts)
+	return e, syms, encodeSymbols(e, syms)
+}
+
+func TestPackedDecoder(t *testing.T) {
+
+	e, syms, data := packedTestData()
+
+	b := e.Decoder().PackTables()
+	if uintptr(unsafe.Pointer(&b[0]))%cacheLine != 0 {
+		t.Errorf("packed tables not cache line aligned")
+	}
+
+	pd, err := DecoderFromPacked(b)
+	if err != nil {
+		t.Fatalf("DecoderFromPacked: %v", err)
+	}
+
+	br := bitstream.NewReader(bytes.NewReader(data))
+	for i, want := range append(syms, EOF) {
+		got, err := pd.ReadSymbol(br)
+		if err != nil {
+			t.Fatalf("symbol %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("symbol %d: got %d, want %d", i, got, want)
+		}
+	}
+
+	if _, err := DecoderFromPacked(b[:len(b)-cacheLine]); err != ErrInvalidCodebook {
+		t.Errorf("truncated tables: err = %v, want %v", err, ErrInvalidCodebook)
+	}
+}
+
+func BenchmarkReadSymbol(b *testing.B) {
+	e, syms, data := packedTestData()
+	d := e.Decoder()
+	b.SetBytes(int64(len(syms)))
+	for i := 0; i < b.N; i++ {
+		br := bitstream.NewReader(bytes.NewReader(data))
+		for {
+			s, err := d.ReadSymbol(br)
+			if err != nil || s == EOF {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkReadSymbolPacked(b *testing.B) {
+	e, syms, data := packedTestData()
+	d, _ := DecoderFromPacked(e.Decoder().PackTables())
+	b.SetBytes(int64(len(syms)))
+	for i := 0; i < b.N; i++ {
+		br := bitstream.NewReader(bytes.NewReader(data))
+		for {
+			s, err := d.ReadSymbol(br)
+			if err != nil || s == EOF {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package huff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// CodebookPatch returns the changes that turn the code lengths of prev into
+// those of next: the size of next's alphabet, then for each symbol whose
+// length differs, its distance from the previous changed symbol and the
+// change in length.
+func CodebookPatch(prev, next *Decoder) []byte {
+	pl, nl := prev.lengths(), next.lengths()
+
+	type change struct {
+		gap   uint64
+		delta int64
+	}
+	var changes []change
+	last := -1
+	for i, l := range nl {
+		var p int
+		if i < len(pl) {
+			p = pl[i]
+		}
+		if l != p {
+			changes = append(changes, change{uint64(i - last - 1), int64(l - p)})
+			last = i
+		}
+	}
+
+	var b []byte
+	b = binary.AppendUvarint(b, uint64(len(nl)))
+	b = binary.AppendUvarint(b, uint64(len(changes)))
+	for _, c := range changes {
+		b = binary.AppendUvarint(b, c.gap)
+		b = binary.AppendVarint(b, c.delta)
+	}
+	return b
+}
+
+// ApplyCodebookPatch returns the decoder for the codebook described by
+// applying patch, from CodebookPatch, to the code lengths of old.  Only the
+// symbols with a code are kept, so the memory it needs depends on old and
+// on the patch, not on the size of the alphabet the patch claims.
+func ApplyCodebookPatch(old *Decoder, patch []byte) (*Decoder, error) {
+	r := bytes.NewReader(patch)
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > math.MaxUint32 {
+		return nil, ErrInvalidCodebook
+	}
+	nchanges, err := binary.ReadUvarint(r)
+	// every change takes at least two bytes
+	if err != nil || nchanges > uint64(r.Len()/2) {
+		return nil, ErrInvalidCodebook
+	}
+
+	type change struct {
+		sym   uint64
+		delta int64
+	}
+	changes := make([]change, nchanges)
+	var next uint64
+	for k := range changes {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil || gap >= n-next {
+			return nil, ErrInvalidCodebook
+		}
+		delta, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, ErrInvalidCodebook
+		}
+		changes[k] = change{next + gap, delta}
+		next += gap + 1
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrInvalidCodebook
+	}
+
+	ol := old.lengths()
+
+	// any symbols past both the old alphabet and the last change are unused,
+	// and a codebook never ends in those
+	if n > uint64(len(ol)) && n > next {
+		return nil, ErrInvalidCodebook
+	}
+
+	// changes are in symbol order, so merge them into the old lengths
+	var used codebook
+	add := func(s uint64, l int) {
+		if l != 0 {
+			used = append(used, symbol{s: uint32(s), length: l})
+		}
+	}
+	var k int
+	for i := uint64(0); i < uint64(len(ol)) && i < n; i++ {
+		l := ol[i]
+		if k < len(changes) && changes[k].sym == i {
+			l += int(changes[k].delta)
+			k++
+		}
+		add(i, l)
+	}
+	for ; k < len(changes); k++ {
+		add(changes[k].sym, int(changes[k].delta))
+	}
+
+	if err := used.validate(); err != nil {
+		return nil, err
+	}
+
+	sptrs, numl := used.calculateCodes()
+
+	return &Decoder{
+		eof:   uint32(n) - 1,
+		numl:  numl,
+		sym:   sptrs,
+		total: -1,
+	}, nil
+}
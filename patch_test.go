@@ -0,0 +1,111 @@
+package huff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestCodebookPatch(t *testing.T) {
+
+	counts := make([]int, 200)
+	for i := range counts {
+		counts[i] = i + 1
+	}
+	before := NewEncoder(counts)
+
+	// swap two counts and add a symbol past a gap of unused ones
+	counts[5], counts[150] = counts[150], counts[5]
+	counts = append(counts, 0, 0, 3)
+	after := NewEncoder(counts)
+	old, want := before.Decoder(), after.Decoder()
+
+	patch := CodebookPatch(old, want)
+	if len(patch) > len(after.CodebookBytes())/10 {
+		t.Errorf("patch is %d bytes, codebook only %d", len(patch), len(after.CodebookBytes()))
+	}
+
+	got, err := ApplyCodebookPatch(old, patch)
+	if err != nil {
+		t.Fatalf("ApplyCodebookPatch: %v", err)
+	}
+
+	cb, _ := makeCodebook(got.lengths()).MarshalBinary()
+	if !bytes.Equal(cb, after.CodebookBytes()) {
+		t.Errorf("patched codebook = %v, want %v", cb, after.CodebookBytes())
+	}
+
+	syms := []uint32{0, 5, 150, 202, 199, 202}
+	dec, err := got.DecodeBytes(encodeSymbols(after, syms))
+	if err != nil || len(dec) != len(syms) {
+		t.Fatalf("DecodeBytes = %v (%v), want %v", dec, err, syms)
+	}
+	for i := range syms {
+		if dec[i] != syms[i] {
+			t.Fatalf("DecodeBytes = %v, want %v", dec, syms)
+		}
+	}
+
+	// shrinking works too, and an empty patch is the identity
+	if got, err := ApplyCodebookPatch(want, CodebookPatch(want, old)); err != nil || !equalLengths(got, old) {
+		t.Errorf("reverse patch: %v", err)
+	}
+	if got, err := ApplyCodebookPatch(old, CodebookPatch(old, old)); err != nil || !equalLengths(got, old) {
+		t.Errorf("empty patch: %v", err)
+	}
+
+	for _, bad := range [][]byte{nil, {3}, {3, 1, 5, 1}, append(patch, 0)} {
+		if _, err := ApplyCodebookPatch(old, bad); err != ErrInvalidCodebook {
+			t.Errorf("ApplyCodebookPatch(%v) err = %v, want %v", bad, err, ErrInvalidCodebook)
+		}
+	}
+}
+
+func TestApplyCodebookPatchHuge(t *testing.T) {
+
+	old := NewEncoder([]int{1, 2, 3}).Decoder()
+	ol := old.lengths()
+
+	// an alphabet of 1<<36 symbols with one changed at the very end
+	var huge []byte
+	huge = binary.AppendUvarint(huge, 1<<36)
+	huge = binary.AppendUvarint(huge, 1)
+	huge = binary.AppendUvarint(huge, 1<<36-1)
+	huge = binary.AppendVarint(huge, 1)
+	if _, err := ApplyCodebookPatch(old, huge); err != ErrInvalidCodebook {
+		t.Errorf("ApplyCodebookPatch(1<<36 symbols) err = %v, want %v", err, ErrInvalidCodebook)
+	}
+
+	// moving EOF to the end of a full 32 bit alphabet is fine, and cheap
+	n := uint64(math.MaxUint32)
+	eof := uint64(len(ol) - 1)
+	l := int64(ol[eof])
+	var big []byte
+	big = binary.AppendUvarint(big, n)
+	big = binary.AppendUvarint(big, 2)
+	big = binary.AppendUvarint(big, eof)
+	big = binary.AppendVarint(big, -l)
+	big = binary.AppendUvarint(big, n-1-eof-1)
+	big = binary.AppendVarint(big, l)
+	d, err := ApplyCodebookPatch(old, big)
+	if err != nil {
+		t.Fatalf("ApplyCodebookPatch(%d symbols): %v", n, err)
+	}
+	if d.eof != uint32(n-1) {
+		t.Errorf("eof = %d, want %d", d.eof, n-1)
+	}
+}
+
+func equalLengths(a, b *Decoder) bool {
+	la, lb := a.lengths(), b.lengths()
+	if len(la) != len(lb) {
+		return false
+	}
+	for i := range la {
+		if la[i] != lb[i] {
+			return false
+		}
+	}
+	return true
+}
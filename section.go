@@ -0,0 +1,99 @@
+package huff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// WriteSection writes syms encoded with enc as an independently decodable
+// section: the length in bytes of the rest of the section, the codebook,
+// and the encoded symbols.
+func WriteSection(w io.Writer, enc *Encoder, syms []uint32) error {
+	var b bytes.Buffer
+	b.Write(enc.CodebookBytes())
+
+	sw := enc.Writer(&b)
+	for _, s := range syms {
+		if _, err := sw.WriteSymbol(s); err != nil {
+			return err
+		}
+	}
+	if _, err := sw.WriteSymbol(EOF); err != nil {
+		return err
+	}
+	if _, err := sw.CloseN(); err != nil {
+		return err
+	}
+
+	var vbuf [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(vbuf[:], uint64(b.Len()))
+	if _, err := w.Write(vbuf[:l]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// byteReader reads single bytes from r, so reading a length prefix doesn't
+// consume anything after it.
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	_, err := io.ReadFull(b.r, buf[:])
+	return buf[0], err
+}
+
+func readSectionLen(r io.Reader) (int64, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+
+	l, err := binary.ReadUvarint(br)
+	if err == io.EOF {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int64(l), nil
+}
+
+// ReadSection reads and decodes the next section from r.  It returns io.EOF
+// if there are no more sections.
+func ReadSection(r io.Reader) ([]uint32, error) {
+	l, err := readSectionLen(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, l))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != l {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return decodeWithCodebook(data)
+}
+
+// SkipSection skips the next section in r without decoding it.  It returns
+// io.EOF if there are no more sections.
+func SkipSection(r io.Reader) error {
+	l, err := readSectionLen(r)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.CopyN(io.Discard, r, l)
+	if n != l {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
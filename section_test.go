@@ -0,0 +1,66 @@
+package huff
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSections(t *testing.T) {
+
+	sections := [][]uint32{
+		{0, 1, 0, 0, 2, 1, 0},
+		{10, 11, 12, 12, 12, 13, 10, 9},
+		{5, 5, 5, 5},
+	}
+
+	var b bytes.Buffer
+	for i, syms := range sections {
+		var max uint32
+		for _, s := range syms {
+			if s > max {
+				max = s
+			}
+		}
+		counts := make([]int, max+1)
+		for _, s := range syms {
+			counts[s]++
+		}
+		if err := WriteSection(&b, NewEncoder(counts), syms); err != nil {
+			t.Fatalf("WriteSection(%d): %v", i, err)
+		}
+	}
+
+	// hide the ByteReader implementation of bytes.Buffer
+	r := struct{ io.Reader }{&b}
+
+	if err := SkipSection(r); err != nil {
+		t.Fatalf("SkipSection: %v", err)
+	}
+
+	got, err := ReadSection(r)
+	if err != nil {
+		t.Fatalf("ReadSection: %v", err)
+	}
+	if want := sections[1]; len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, s := range sections[1] {
+		if got[i] != s {
+			t.Fatalf("got %v, want %v", got, sections[1])
+		}
+	}
+
+	if err := SkipSection(r); err != nil {
+		t.Fatalf("SkipSection: %v", err)
+	}
+	if _, err := ReadSection(r); err != io.EOF {
+		t.Errorf("after last section: err = %v, want io.EOF", err)
+	}
+
+	var short bytes.Buffer
+	WriteSection(&short, NewEncoder([]int{1, 1}), []uint32{0, 1})
+	if _, err := ReadSection(bytes.NewReader(short.Bytes()[:short.Len()-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated section: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,95 @@
+package huff
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// NewEncoderSeeded is like NewEncoder, but breaks ties between equal weights
+// with keys derived from seed rather than from symbol numbers.  The code
+// lengths depend only on seed and the multiset of counts, so reordering
+// counts reorders the lengths with them; among symbols with equal counts,
+// the shorter codes go to the lower symbols.  Different seeds may pick
+// different, equally optimal, codebooks.
+func NewEncoderSeeded(counts []int, seed int64) *Encoder {
+	eof := uint32(len(counts))
+
+	// the symbols in use, plus EOF, ordered by count then symbol
+	var syms []uint32
+	for i, v := range counts {
+		if v != 0 {
+			syms = append(syms, uint32(i))
+		}
+	}
+	syms = append(syms, eof)
+
+	weight := func(s uint32) int {
+		if s == eof {
+			return 0
+		}
+		return counts[s]
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return weight(syms[i]) < weight(syms[j]) })
+
+	// a leaf's key is fixed by its weight and its rank among equal weights
+	var n nodes
+	var rank int
+	for i, s := range syms {
+		w := weight(s)
+		if i > 0 && w == weight(syms[i-1]) {
+			rank++
+		} else {
+			rank = 0
+		}
+		heap.Push(&n, node{weight: w, leaf: true, sym: seedKey(seed, w, rank)})
+	}
+
+	// the leaves of each weight are interchangeable, so only their depths matter
+	depths := make(map[int][]int)
+	root := buildTree(n)
+	leafDepths(root, 0, depths)
+	if root.leaf {
+		// only EOF, which still needs one bit
+		depths[0] = []int{1}
+	}
+	for _, d := range depths {
+		sort.Ints(d)
+	}
+
+	m := make(codebook, eof+1)
+	for i := range m {
+		m[i].s = uint32(i)
+	}
+	for i, s := range syms {
+		w := weight(s)
+		if i > 0 && w == weight(syms[i-1]) {
+			rank++
+		} else {
+			rank = 0
+		}
+		m[s].length = depths[w][rank]
+		m[s].weight = w
+	}
+
+	sptrs, numl := m.calculateCodes()
+
+	return &Encoder{eof: eof, m: m, sym: sptrs, numl: numl}
+}
+
+// seedKey mixes seed, w and rank with splitmix64
+func seedKey(seed int64, w, rank int) uint32 {
+	z := uint64(seed) + uint64(w)*0x9e3779b97f4a7c15 + uint64(rank)*0xc2b2ae3d27d4eb4f
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return uint32((z ^ z>>31) >> 32)
+}
+
+// leafDepths appends the depth of each leaf below n to d, keyed by its weight
+func leafDepths(n *node, depth int, d map[int][]int) {
+	if n.leaf {
+		d[n.weight] = append(d[n.weight], depth)
+		return
+	}
+	leafDepths(n.child[0], depth+1, d)
+	leafDepths(n.child[1], depth+1, d)
+}
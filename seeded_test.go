@@ -0,0 +1,91 @@
+package huff
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderSeeded(t *testing.T) {
+
+	counts := []int{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5, 8, 9, 7, 9, 3, 2, 3, 8, 4, 6, 2, 6, 4, 3}
+
+	// the lengths given to each count, in symbol order
+	byCount := func(e *Encoder, counts []int) map[int][]int {
+		m := make(map[int][]int)
+		for i, v := range counts {
+			m[v] = append(m[v], e.SymbolLen(uint32(i)))
+		}
+		return m
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for seed := int64(0); seed < 20; seed++ {
+		e := NewEncoderSeeded(counts, seed)
+
+		if got, want := totalBits(e, counts), totalBits(NewEncoder(counts), counts); got != want {
+			t.Errorf("seed %d: total bits = %d, want %d", seed, got, want)
+		}
+
+		if again := NewEncoderSeeded(counts, seed); !bytes.Equal(again.CodebookBytes(), e.CodebookBytes()) {
+			t.Errorf("seed %d: codebook not reproducible", seed)
+		}
+
+		want := byCount(e, counts)
+		for c, ls := range want {
+			for i := 1; i < len(ls); i++ {
+				if ls[i] < ls[i-1] {
+					t.Errorf("seed %d: count %d lengths %v not increasing", seed, c, ls)
+				}
+			}
+		}
+
+		for k := 0; k < 5; k++ {
+			perm := make([]int, len(counts))
+			for i, j := range rnd.Perm(len(counts)) {
+				perm[i] = counts[j]
+			}
+			p := NewEncoderSeeded(perm, seed)
+			if got := byCount(p, perm); !reflect.DeepEqual(got, want) {
+				t.Errorf("seed %d: permuted counts gave lengths %v, want %v", seed, got, want)
+			}
+			if !reflect.DeepEqual(p.numl, e.numl) {
+				t.Errorf("seed %d: permuted numl = %v, want %v", seed, p.numl, e.numl)
+			}
+		}
+	}
+}
+
+func TestEncoderSeededLone(t *testing.T) {
+
+	e := NewEncoderSeeded(nil, 42)
+	if l := e.SymbolLen(EOF); l != 1 {
+		t.Errorf("EOF length = %d, want 1", l)
+	}
+
+	e = NewEncoderSeeded([]int{0, 7}, 42)
+	if e.SymbolLen(1) != 1 || e.SymbolLen(EOF) != 1 || e.SymbolLen(0) != 0 {
+		t.Errorf("lengths = %d %d %d, want 0 1 1", e.SymbolLen(0), e.SymbolLen(1), e.SymbolLen(EOF))
+	}
+}
+
+func TestEncoderSeededChoice(t *testing.T) {
+
+	// several optimal codebooks exist for these counts
+	counts := []int{1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 4, 4}
+
+	want := totalBits(NewEncoder(counts), counts)
+	profiles := make(map[string]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		e := NewEncoderSeeded(counts, seed)
+		if got := totalBits(e, counts); got != want {
+			t.Errorf("seed %d: total bits = %d, want %d", seed, got, want)
+		}
+		profiles[string(e.CodebookBytes())] = true
+	}
+
+	if len(profiles) < 2 {
+		t.Errorf("20 seeds gave %d codebooks, want several", len(profiles))
+	}
+}
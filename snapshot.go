@@ -0,0 +1,149 @@
+package huff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// snapshotVersion is bumped only for changes older readers can't skip over
+const snapshotVersion = 1
+
+// snapshot fields, each written as tag, length, value
+const (
+	snapCodebook = 1 + iota // the serialized codebook
+	snapEOF                 // the EOF symbol, len(codebook) for no EOF
+	snapWeights             // the count each code was built from
+	snapAliases             // pairs of aliased symbol and target
+)
+
+var ErrSnapshotVersion = errors.New("huff: unsupported snapshot version")
+
+// Snapshot serializes the complete state of the encoder: its codebook, EOF
+// symbol, aliases and the counts it was built from.  It is a
+// version byte followed by tagged fields; RestoreEncoder skips fields it
+// doesn't know, so snapshots from newer versions still restore, as long as
+// they don't change the version.
+func (e *Encoder) Snapshot() ([]byte, error) {
+	b := []byte{snapshotVersion}
+
+	field := func(tag uint64, v []byte) {
+		b = binary.AppendUvarint(b, tag)
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+
+	field(snapCodebook, e.CodebookBytes())
+	field(snapEOF, binary.AppendUvarint(nil, uint64(e.eof)))
+
+	var w []byte
+	e.each(func(_ uint32, sym symbol) {
+		w = binary.AppendUvarint(w, uint64(sym.weight))
+	})
+	field(snapWeights, w)
+
+	if len(e.alias) != 0 {
+		aliases := make([]uint32, 0, len(e.alias))
+		for s := range e.alias {
+			aliases = append(aliases, s)
+		}
+		sort.Slice(aliases, func(i, j int) bool { return aliases[i] < aliases[j] })
+
+		var a []byte
+		for _, s := range aliases {
+			a = binary.AppendUvarint(a, uint64(s))
+			a = binary.AppendUvarint(a, uint64(e.alias[s]))
+		}
+		field(snapAliases, a)
+	}
+
+	return b, nil
+}
+
+// RestoreEncoder returns the encoder saved by Snapshot.  The restored
+// encoder writes exactly the same bits as the original.
+func RestoreEncoder(data []byte) (*Encoder, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidCodebook
+	}
+	if data[0] != snapshotVersion {
+		return nil, ErrSnapshotVersion
+	}
+
+	r := bytes.NewReader(data[1:])
+
+	var e Encoder
+	var haveCodebook, haveEOF bool
+	var weights, aliases []byte
+	for r.Len() != 0 {
+		tag, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrInvalidCodebook
+		}
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len()) {
+			return nil, ErrInvalidCodebook
+		}
+		v := make([]byte, l)
+		io.ReadFull(r, v)
+
+		switch tag {
+		case snapCodebook:
+			if err := e.m.UnmarshalBinary(v); err != nil {
+				return nil, err
+			}
+			haveCodebook = true
+		case snapEOF:
+			eof, n := binary.Uvarint(v)
+			if n <= 0 {
+				return nil, ErrInvalidCodebook
+			}
+			e.eof = uint32(eof)
+			haveEOF = true
+		case snapWeights:
+			weights = v
+		case snapAliases:
+			aliases = v
+		}
+	}
+
+	if !haveCodebook || !haveEOF || uint64(e.eof) > uint64(len(e.m)) {
+		return nil, ErrInvalidCodebook
+	}
+	if err := e.m.validate(); err != nil {
+		return nil, err
+	}
+
+	if weights != nil {
+		wr := bytes.NewReader(weights)
+		for i := range e.m {
+			w, err := binary.ReadUvarint(wr)
+			if err != nil {
+				return nil, ErrInvalidCodebook
+			}
+			e.m[i].weight = int(w)
+		}
+	}
+
+	if aliases != nil {
+		e.alias = make(map[uint32]uint32)
+		ar := bytes.NewReader(aliases)
+		for ar.Len() != 0 {
+			s, err := binary.ReadUvarint(ar)
+			if err != nil {
+				return nil, ErrInvalidCodebook
+			}
+			t, err := binary.ReadUvarint(ar)
+			if err != nil || s >= uint64(len(e.m)) || t >= uint64(len(e.m)) {
+				return nil, ErrInvalidCodebook
+			}
+			e.alias[uint32(s)] = uint32(t)
+		}
+	}
+
+	e.sym, e.numl = e.m.calculateCodes()
+
+	return &e, nil
+}
@@ -0,0 +1,98 @@
+package huff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	counts := []int{10, 0, 3, 7, 1, 0, 2, 40}
+	syms := []uint32{0, 2, 3, 6, 4, 7, 7, 3}
+
+	aliased, _ := NewEncoderAliased(counts, map[uint32]uint32{4: 7, 6: 0})
+	pairs, _ := NewEncoderFromPairs([]SymCount{{0, 10}, {3, 7}, {9, 5}})
+
+	for name, e := range map[string]*Encoder{
+		"plain":   NewEncoder(counts),
+		"aliased": aliased,
+		"pairs":   pairs,
+	} {
+		in := syms
+		if name == "pairs" {
+			in = []uint32{0, 3, 9, 9, 0}
+		}
+
+		// a payload written before the snapshot was taken
+		payload := encodeSymbols(e, in)
+		want, err := e.Decoder().DecodeBytes(payload)
+		if err != nil {
+			t.Fatalf("%s: DecodeBytes: %v", name, err)
+		}
+
+		snap, err := e.Snapshot()
+		if err != nil {
+			t.Fatalf("%s: Snapshot: %v", name, err)
+		}
+		r, err := RestoreEncoder(snap)
+		if err != nil {
+			t.Fatalf("%s: RestoreEncoder: %v", name, err)
+		}
+
+		if got, err := r.Decoder().DecodeBytes(payload); err != nil || !slices.Equal(got, want) {
+			t.Errorf("%s: restored DecodeBytes = %v (%v), want %v", name, got, err, want)
+		}
+		if got := encodeSymbols(r, in); !bytes.Equal(got, payload) {
+			t.Errorf("%s: restored encoding = %x, want %x", name, got, payload)
+		}
+		if r.Gini() != e.Gini() || r.eof != e.eof {
+			t.Errorf("%s: restored state differs", name)
+		}
+	}
+
+	// a no-EOF encoder keeps refusing EOF
+	noEOF := NewEncoderNoEOF(counts)
+	snap, _ := noEOF.Snapshot()
+	r, err := RestoreEncoder(snap)
+	if err != nil {
+		t.Fatalf("no EOF: RestoreEncoder: %v", err)
+	}
+	if _, err := r.Writer(&bytes.Buffer{}).WriteSymbol(EOF); err != ErrUnknownSymbol {
+		t.Errorf("no EOF: WriteSymbol(EOF) err = %v, want %v", err, ErrUnknownSymbol)
+	}
+	if !bytes.Equal(encodeNoEOF(r, syms...), encodeNoEOF(noEOF, syms...)) {
+		t.Errorf("no EOF: restored encoding differs")
+	}
+}
+
+func TestSnapshotCompat(t *testing.T) {
+
+	e := NewEncoder([]int{5, 4, 3})
+	snap, _ := e.Snapshot()
+
+	// a field from some later version
+	future := binary.AppendUvarint(append([]byte(nil), snap...), 99)
+	future = binary.AppendUvarint(future, 3)
+	future = append(future, 1, 2, 3)
+
+	r, err := RestoreEncoder(future)
+	if err != nil {
+		t.Fatalf("unknown field: %v", err)
+	}
+	if !bytes.Equal(r.CodebookBytes(), e.CodebookBytes()) {
+		t.Errorf("unknown field: codebook = %v, want %v", r.CodebookBytes(), e.CodebookBytes())
+	}
+
+	bad := append([]byte{snapshotVersion + 1}, snap[1:]...)
+	if _, err := RestoreEncoder(bad); err != ErrSnapshotVersion {
+		t.Errorf("version: err = %v, want %v", err, ErrSnapshotVersion)
+	}
+
+	for _, b := range [][]byte{nil, snap[:1], snap[:len(snap)-1], {snapshotVersion, snapEOF, 1, 3}} {
+		if _, err := RestoreEncoder(b); err != ErrInvalidCodebook {
+			t.Errorf("RestoreEncoder(%v) err = %v, want %v", b, err, ErrInvalidCodebook)
+		}
+	}
+}
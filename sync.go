@@ -0,0 +1,142 @@
+package huff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+// SyncMarker is written after every sync point's zero padding.
+var SyncMarker = []byte{0x00, 0xff, 0xa5, 0x5a}
+
+var (
+	ErrNoSyncMarker = errors.New("huff: missing sync marker")
+	ErrSyncInterval = errors.New("huff: sync interval must be positive")
+)
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// SyncWriter is a Writer that pads to a byte boundary and writes SyncMarker
+// after every `every` symbols, so decoding can begin at any sync point.
+type SyncWriter struct {
+	w       *Writer
+	cw      *countWriter
+	every   int
+	n       int
+	offsets []int64
+	closed  bool
+}
+
+// SyncWriter returns a SyncWriter writing to w.  It returns ErrSyncInterval
+// if every isn't positive.
+func (e *Encoder) SyncWriter(w io.Writer, every int) (*SyncWriter, error) {
+	if every <= 0 {
+		return nil, ErrSyncInterval
+	}
+	cw := &countWriter{w: w}
+	return &SyncWriter{w: e.Writer(cw), cw: cw, every: every}, nil
+}
+
+// WriteSymbol writes s, first writing a sync point if every symbols have
+// been written since the last one.  Symbols that fail to write don't count.
+func (w *SyncWriter) WriteSymbol(s uint32) (int, error) {
+	if w.n > 0 && w.n%w.every == 0 && len(w.offsets) < w.n/w.every {
+		if err := w.sync(); err != nil {
+			return 0, err
+		}
+	}
+	l, err := w.w.WriteSymbol(s)
+	if err != nil {
+		return l, err
+	}
+	w.n++
+	return l, nil
+}
+
+func (w *SyncWriter) sync() error {
+	if err := w.w.Flush(bitstream.Zero); err != nil {
+		return err
+	}
+	if _, err := w.cw.Write(SyncMarker); err != nil {
+		return err
+	}
+	w.offsets = append(w.offsets, w.cw.n)
+	return nil
+}
+
+// Close writes EOF and flushes the stream.  Closing it again does nothing.
+func (w *SyncWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if _, err := w.WriteSymbol(EOF); err != nil {
+		return err
+	}
+	return w.w.Flush(bitstream.Zero)
+}
+
+// Offsets returns the byte offsets just past each sync marker written so far.
+// Decoding from the i'th offset resumes at symbol (i+1)*every.
+func (w *SyncWriter) Offsets() []int64 {
+	return w.offsets
+}
+
+// NextSync returns the offset just past the first SyncMarker in data, or -1.
+// Encoded symbols can contain the marker bytes, so a match found by scanning
+// is only a candidate; Offsets gives the exact positions.
+func NextSync(data []byte) int {
+	i := bytes.Index(data, SyncMarker)
+	if i < 0 {
+		return -1
+	}
+	return i + len(SyncMarker)
+}
+
+// DecodeSync decodes a stream written by a SyncWriter with the same value of
+// every, starting at the beginning of the stream or at a sync offset.  It
+// returns ErrSyncInterval if every isn't positive.
+func (d *Decoder) DecodeSync(data []byte, every int) ([]uint32, error) {
+	if every <= 0 {
+		return nil, ErrSyncInterval
+	}
+
+	r := bytes.NewReader(data)
+	br := bitstream.NewReader(r)
+
+	marker := make([]byte, len(SyncMarker))
+
+	var out []uint32
+	for n := 0; ; n++ {
+		if n > 0 && n%every == 0 {
+			// the remaining bits in br are padding; the marker starts at the next byte of r
+			if _, err := io.ReadFull(r, marker); err != nil || !bytes.Equal(marker, SyncMarker) {
+				return out, ErrNoSyncMarker
+			}
+			br = bitstream.NewReader(r)
+		}
+
+		s, err := d.ReadSymbol(br)
+		if err == io.EOF {
+			return out, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return out, err
+		}
+		if s == EOF {
+			return out, nil
+		}
+		out = append(out, s)
+	}
+}
@@ -0,0 +1,84 @@
+package huff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSyncWriter(t *testing.T) {
+
+	const every = 16
+
+	counts := make([]int, 64)
+	var syms []uint32
+	for i := 0; i < 1000; i++ {
+		s := uint32((i * 7 % 13) * (i % 5))
+		syms = append(syms, s)
+		counts[s]++
+	}
+
+	e := NewEncoder(counts)
+
+	var b bytes.Buffer
+	w, err := e.SyncWriter(&b, every)
+	if err != nil {
+		t.Fatalf("SyncWriter: %v", err)
+	}
+	for i, s := range syms {
+		// failed writes mustn't move the sync points
+		if i%10 == 0 {
+			if _, err := w.WriteSymbol(63); err != ErrUnknownSymbol {
+				t.Fatalf("unknown symbol: err = %v, want %v", err, ErrUnknownSymbol)
+			}
+		}
+		w.WriteSymbol(s)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	n := b.Len()
+	if err := w.Close(); err != nil || b.Len() != n {
+		t.Fatalf("second Close: %v, wrote %d more bytes", err, b.Len()-n)
+	}
+
+	data := b.Bytes()
+	d := e.Decoder()
+
+	offsets := append([]int64{0}, w.Offsets()...)
+	if want := len(syms)/every + 1; len(offsets) != want {
+		t.Fatalf("got %d sync points, want %d", len(offsets), want)
+	}
+
+	for i, off := range offsets {
+		got, err := d.DecodeSync(data[off:], every)
+		if err != nil {
+			t.Fatalf("sync point %d: %v", i, err)
+		}
+		want := syms[i*every:]
+		if len(got) != len(want) {
+			t.Fatalf("sync point %d: got %d symbols, want %d", i, len(got), len(want))
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("sync point %d: symbol %d = %d, want %d", i, j, got[j], want[j])
+			}
+		}
+	}
+
+	if n := NextSync(data); n < 0 || int64(n) > offsets[1] {
+		t.Errorf("NextSync = %d, first sync point at %d", n, offsets[1])
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+
+	e := NewEncoder([]int{3, 2, 1})
+	for _, every := range []int{0, -1} {
+		if _, err := e.SyncWriter(&bytes.Buffer{}, every); err != ErrSyncInterval {
+			t.Errorf("SyncWriter(%d): err = %v, want %v", every, err, ErrSyncInterval)
+		}
+		if _, err := e.Decoder().DecodeSync(encodeSymbols(e, []uint32{0, 1}), every); err != ErrSyncInterval {
+			t.Errorf("DecodeSync(%d): err = %v, want %v", every, err, ErrSyncInterval)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package huff
+
+import (
+	"errors"
+	"io"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+// TupleEncoder encodes fixed-size tuples of symbols, using a separate
+// encoder for each position in the tuple.
+type TupleEncoder struct {
+	e []*Encoder
+}
+
+func NewTupleEncoder(e ...*Encoder) *TupleEncoder {
+	return &TupleEncoder{e: e}
+}
+
+// Decoder returns a TupleDecoder for the channel encoders.
+func (t *TupleEncoder) Decoder() *TupleDecoder {
+	d := make([]*Decoder, len(t.e))
+	for i, e := range t.e {
+		d[i] = e.Decoder()
+	}
+	return NewTupleDecoder(d...)
+}
+
+func (t *TupleEncoder) Writer(w io.Writer) *TupleWriter {
+	bw := bitstream.NewWriter(w)
+	tw := &TupleWriter{BitWriter: bw, w: make([]*Writer, len(t.e))}
+	for i, e := range t.e {
+		tw.w[i] = &Writer{e: e, BitWriter: bw}
+	}
+	return tw
+}
+
+type TupleWriter struct {
+	*bitstream.BitWriter
+	w      []*Writer
+	closed bool
+}
+
+var ErrTupleSize = errors.New("huff: wrong tuple size")
+
+// WriteTuple writes one symbol per channel, in channel order.
+func (w *TupleWriter) WriteTuple(syms []uint32) (int, error) {
+	if len(syms) != len(w.w) {
+		return 0, ErrTupleSize
+	}
+
+	var bits int
+	for i, s := range syms {
+		if s == EOF {
+			return bits, ErrUnknownSymbol
+		}
+		n, err := w.w[i].WriteSymbol(s)
+		bits += n
+		if err != nil {
+			return bits, err
+		}
+	}
+
+	return bits, nil
+}
+
+// Close writes EOF using the first channel's codebook and flushes the stream.
+func (w *TupleWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.w) > 0 {
+		w.w[0].WriteSymbol(EOF)
+	}
+	return w.Flush(bitstream.Zero)
+}
+
+// TupleDecoder decodes tuples written by a TupleWriter.
+type TupleDecoder struct {
+	d []*Decoder
+}
+
+func NewTupleDecoder(d ...*Decoder) *TupleDecoder {
+	return &TupleDecoder{d: d}
+}
+
+// ReadTuple reads one symbol from each channel in order.  It returns io.EOF
+// once the end of the stream is reached.
+func (t *TupleDecoder) ReadTuple(br *bitstream.BitReader) ([]uint32, error) {
+	tuple := make([]uint32, len(t.d))
+	for i, d := range t.d {
+		s, err := d.ReadSymbol(br)
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s == EOF {
+			if i == 0 {
+				return nil, io.EOF
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		tuple[i] = s
+	}
+	return tuple, nil
+}
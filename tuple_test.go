@@ -0,0 +1,59 @@
+package huff
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dgryski/go-bitstream"
+)
+
+func TestTupleRoundtrip(t *testing.T) {
+
+	var pixels [][]uint32
+	for i := 0; i < 500; i++ {
+		pixels = append(pixels, []uint32{uint32(200 + i%7), uint32(i % 31), uint32((i * i) % 5)})
+	}
+
+	var channels [3][]int
+	for c := range channels {
+		channels[c] = make([]int, 256)
+		for _, p := range pixels {
+			channels[c][p[c]]++
+		}
+	}
+
+	te := NewTupleEncoder(NewEncoder(channels[0]), NewEncoder(channels[1]), NewEncoder(channels[2]))
+
+	var b bytes.Buffer
+	w := te.Writer(&b)
+	for _, p := range pixels {
+		if _, err := w.WriteTuple(p); err != nil {
+			t.Fatalf("WriteTuple: %v", err)
+		}
+	}
+	w.Close()
+
+	if _, err := w.WriteTuple([]uint32{1, 2}); err != ErrTupleSize {
+		t.Errorf("short tuple: err = %v, want %v", err, ErrTupleSize)
+	}
+
+	td := te.Decoder()
+	br := bitstream.NewReader(&b)
+
+	for i, p := range pixels {
+		got, err := td.ReadTuple(br)
+		if err != nil {
+			t.Fatalf("tuple %d: %v", i, err)
+		}
+		for c := range p {
+			if got[c] != p[c] {
+				t.Fatalf("tuple %d: got %v, want %v", i, got, p)
+			}
+		}
+	}
+
+	if _, err := td.ReadTuple(br); err != io.EOF {
+		t.Errorf("end of stream: err = %v, want io.EOF", err)
+	}
+}